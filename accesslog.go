@@ -0,0 +1,144 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat selects the line format written by SetAccessLog.
+type AccessLogFormat int
+
+const (
+	// AccessLogCommon is the NCSA Common Log Format.
+	AccessLogCommon AccessLogFormat = iota
+	// AccessLogCombined is the Common Log Format followed by the quoted
+	// Referer and User-Agent headers.
+	AccessLogCombined
+	// AccessLogJSON writes one JSON object per line with the fields
+	// timestamp, method, path, status, duration_ms, bytes, remote_ip,
+	// request_id and user_agent, for log aggregators. request_id is set
+	// when EnableRequestID is used.
+	AccessLogJSON
+)
+
+const commonLogTime = "02/Jan/2006:15:04:05 -0700"
+
+type accessLog struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	format AccessLogFormat
+	closed bool
+}
+
+// SetAccessLog writes a line to writer for every request the Server receives,
+// including those rejected by its middleware. Lines are written one at a time,
+// so writer need not be safe for concurrent use, and it may be buffered: once
+// the Server has finished draining requests on shutdown, writer is flushed if
+// it has a Flush method and closed if it is an io.Closer. Set a new writer
+// before starting the Server again.
+func (s *Server) SetAccessLog(writer io.Writer, format AccessLogFormat) {
+	s.accessLog = &accessLog{writer: writer, format: format}
+}
+
+func (s *Server) logAccess(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &responseWriter{ResponseWriter: writer}
+		handler.ServeHTTP(recorder, request)
+		var requestID string
+		if s.requestIDHeader != "" {
+			requestID = recorder.Header().Get(s.requestIDHeader)
+		}
+		s.accessLog.write(s.ClientIP(request), requestID, start, request, recorder)
+	})
+}
+
+// accessLogEntry is a line of the JSON access log.
+type accessLogEntry struct {
+	Timestamp  string  `json:"timestamp"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Status     int     `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+	Bytes      int64   `json:"bytes"`
+	RemoteIP   string  `json:"remote_ip"`
+	RequestID  string  `json:"request_id,omitempty"`
+	UserAgent  string  `json:"user_agent"`
+}
+
+func (l *accessLog) write(client, requestID string, start time.Time, request *http.Request, response *responseWriter) {
+	var line string
+	if l.format == AccessLogJSON {
+		encoded, err := json.Marshal(accessLogEntry{
+			Timestamp:  start.Format(time.RFC3339Nano),
+			Method:     request.Method,
+			Path:       request.URL.Path,
+			Status:     response.statusCode(),
+			DurationMS: float64(time.Since(start)) / float64(time.Millisecond),
+			Bytes:      response.written,
+			RemoteIP:   client,
+			RequestID:  requestID,
+			UserAgent:  request.UserAgent(),
+		})
+		if err != nil {
+			return
+		}
+		line = string(encoded)
+	} else {
+		line = commonLogLine(l.format, client, start, request, response)
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if !l.closed {
+		io.WriteString(l.writer, line+"\n")
+	}
+}
+
+func commonLogLine(format AccessLogFormat, client string, start time.Time, request *http.Request, response *responseWriter) string {
+	user := "-"
+	if request.URL.User != nil && request.URL.User.Username() != "" {
+		user = request.URL.User.Username()
+	} else if name, _, ok := request.BasicAuth(); ok && name != "" {
+		user = name
+	}
+	status := response.statusCode()
+	size := "-"
+	if response.written > 0 {
+		size = strconv.FormatInt(response.written, 10)
+	}
+	line := fmt.Sprintf("%s - %s [%s] %s %d %s", client, user, start.Format(commonLogTime),
+		strconv.Quote(request.Method+" "+request.RequestURI+" "+request.Proto), status, size)
+	if format == AccessLogCombined {
+		line += " " + strconv.Quote(request.Referer()) + " " + strconv.Quote(request.UserAgent())
+	}
+	return line
+}
+
+// close flushes and closes the writer. Requests that outlive the drain are
+// not logged.
+func (l *accessLog) close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	var err error
+	switch flusher := l.writer.(type) {
+	case interface{ Flush() error }:
+		err = flusher.Flush()
+	case interface{ Flush() }:
+		flusher.Flush()
+	}
+	if closer, ok := l.writer.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
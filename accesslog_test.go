@@ -0,0 +1,119 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bufferedLog is a buffered writer that records when it is closed.
+type bufferedLog struct {
+	*bufio.Writer
+	closed bool
+}
+
+func (l *bufferedLog) Close() error {
+	l.closed = true
+	return nil
+}
+
+func TestAccessLogFlushedOnShutdown(t *testing.T) {
+	var output bytes.Buffer
+	log := &bufferedLog{Writer: bufio.NewWriterSize(&output, 64*1024)}
+	server := New(writeString("hello"))
+	server.SetAccessLog(log, AccessLogCommon)
+	base := startServer(t, server)
+	for i := 0; i < 3; i++ {
+		get(t, base+"/path?q=1")
+	}
+	if output.Len() != 0 {
+		t.Fatal("Expected lines to be buffered before shutdown")
+	}
+	<-server.Stop()
+	if !log.closed {
+		t.Fatal("Expected access log to be closed")
+	}
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, found %d: %q", len(lines), output.String())
+	}
+	pattern := regexp.MustCompile(`^127\.0\.0\.1 - - \[[^\]]+\] "GET /path\?q=1 HTTP/1\.1" 200 5$`)
+	for _, line := range lines {
+		if !pattern.MatchString(line) {
+			t.Fatalf("Unexpected line: %q", line)
+		}
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	var output bytes.Buffer
+	server := New(writeString(""))
+	server.SetAccessLog(&output, AccessLogCombined)
+	base := startServer(t, server)
+	request, _ := http.NewRequest("GET", base+"/", nil)
+	request.SetBasicAuth("alice", "secret")
+	request.Header.Set("Referer", "http://example.com/")
+	request.Header.Set("User-Agent", `agent "quoted"`)
+	post(t, request)
+	<-server.Stop()
+	pattern := regexp.MustCompile(`^127\.0\.0\.1 - alice \[[^\]]+\] "GET / HTTP/1\.1" 200 - "http://example.com/" "agent \\"quoted\\""\n$`)
+	if !pattern.MatchString(output.String()) {
+		t.Fatalf("Unexpected line: %q", output.String())
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	var output bytes.Buffer
+	server := New(writeString("hello"))
+	server.EnableRequestID("X-Request-ID")
+	server.SetAccessLog(&output, AccessLogJSON)
+	base := startServer(t, server)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request, _ := http.NewRequest("GET", base+"/path?q=1", nil)
+			request.Header.Set("User-Agent", `agent "quoted" \ <tag> é`)
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Error("Unexpected error:", err)
+				return
+			}
+			response.Body.Close()
+		}()
+	}
+	wg.Wait()
+	<-server.Stop()
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 20 {
+		t.Fatalf("Expected 20 lines, found %d: %q", len(lines), output.String())
+	}
+	for _, line := range lines {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", line, err)
+		}
+		if entry["method"] != "GET" || entry["path"] != "/path" || entry["status"] != float64(200) || entry["bytes"] != float64(5) {
+			t.Fatalf("Unexpected entry: %q", line)
+		}
+		if entry["remote_ip"] != "127.0.0.1" || entry["user_agent"] != `agent "quoted" \ <tag> é` {
+			t.Fatalf("Unexpected entry: %q", line)
+		}
+		if id, _ := entry["request_id"].(string); id == "" {
+			t.Fatalf("Expected a request ID: %q", line)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, entry["timestamp"].(string)); err != nil {
+			t.Fatalf("Unexpected timestamp: %q", line)
+		}
+		if duration, ok := entry["duration_ms"].(float64); !ok || duration < 0 {
+			t.Fatalf("Unexpected duration: %q", line)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// addedListener is a listener added to a running Server with AddAddress.
+type addedListener struct {
+	address  string
+	listener net.Listener
+	served   chan struct{}
+	draining atomic.Bool
+	conns    atomic.Int64
+	drained  chan struct{}
+	drain    func()
+}
+
+// originListener records which added listener accepted each connection, so
+// that RemoveAddress can drain them.
+type originListener struct {
+	net.Listener
+	server *Server
+	origin *addedListener
+}
+
+func (l *originListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.server.connsMutex.Lock()
+		if l.server.connOrigins == nil {
+			l.server.connOrigins = make(map[net.Conn]*addedListener)
+		}
+		l.server.connOrigins[conn] = l.origin
+		l.server.connsMutex.Unlock()
+	}
+	return conn, err
+}
+
+// AddAddress starts accepting connections on an additional address of the
+// Server's network while it is running, alongside Address. Binding the new
+// address before removing an old one with RemoveAddress moves the Server
+// without any moment when neither is bound. Added addresses are closed when
+// the Server shuts down and are not restored by a later Start.
+func (s *Server) AddAddress(address string) error {
+	s.startMutex.Lock()
+	defer s.startMutex.Unlock()
+	if !s.IsListening() {
+		return ErrNotRunning
+	}
+	listener, err := s.listen(s.network, address)
+	if err != nil {
+		return err
+	}
+	<-s.started
+	drained := make(chan struct{})
+	origin := &addedListener{
+		address:  address,
+		listener: listener,
+		served:   make(chan struct{}),
+		drained:  drained,
+		drain:    sync.OnceFunc(func() { close(drained) }),
+	}
+	s.mutex.Lock()
+	if !s.listening {
+		s.mutex.Unlock()
+		listener.Close()
+		return ErrNotRunning
+	}
+	s.added = append(s.added, origin)
+	s.background.Add(1)
+	s.mutex.Unlock()
+	go func() {
+		defer s.background.Done()
+		defer close(origin.served)
+		s.serve(&originListener{Listener: listener, server: s, origin: origin})
+	}()
+	return nil
+}
+
+// RemoveAddress stops accepting connections on an address added with
+// AddAddress, identified either as it was passed to AddAddress or by its bound
+// address, and drains the connections accepted on it: requests in progress
+// are completed and each connection is closed once idle. It returns once they
+// have all closed, or once the shutdown timeout expires if one is set. The
+// primary address cannot be removed; use Restart to move it.
+func (s *Server) RemoveAddress(address string) error {
+	s.mutex.Lock()
+	var origin *addedListener
+	for i, added := range s.added {
+		if added.address == address || added.listener.Addr().String() == address {
+			origin = added
+			s.added = append(s.added[:i:i], s.added[i+1:]...)
+			break
+		}
+	}
+	primary := s.Address() != nil && s.Address().String() == address
+	s.mutex.Unlock()
+	if origin == nil {
+		if primary {
+			return errors.New("httpserver: the primary address cannot be removed")
+		}
+		return fmt.Errorf("httpserver: no added listener on %s", address)
+	}
+	origin.listener.Close()
+	// Serve registers each connection it accepts before returning, so once
+	// it has returned every connection from this listener is tracked.
+	<-origin.served
+	origin.draining.Store(true)
+	s.connsMutex.Lock()
+	for _, tracked := range s.conns {
+		if tracked.origin == origin && tracked.idle.Load() {
+			tracked.Close()
+		}
+	}
+	s.connsMutex.Unlock()
+	if origin.conns.Load() == 0 {
+		origin.drain()
+	}
+	var timeout <-chan time.Time
+	if s.shutdownTimeout > 0 {
+		timer := time.NewTimer(s.shutdownTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-origin.drained:
+	case <-timeout:
+	}
+	return nil
+}
+
+// Addresses returns every address the Server is accepting connections on:
+// Address followed by those added with AddAddress.
+func (s *Server) Addresses() []net.Addr {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	primary := s.Address()
+	if primary == nil {
+		return nil
+	}
+	addresses := []net.Addr{primary}
+	for _, added := range s.added {
+		addresses = append(addresses, added.listener.Addr())
+	}
+	return addresses
+}
@@ -0,0 +1,112 @@
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAddRemoveAddress(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/block" {
+			entered <- struct{}{}
+			<-release
+		}
+		writer.Write([]byte("OK"))
+	})
+	server.SetQuiet(true)
+	if err := server.AddAddress("127.0.0.1:0"); err != ErrNotRunning {
+		t.Fatal("Expected ErrNotRunning, received", err)
+	}
+	base := startServer(t, server)
+	if err := server.AddAddress("127.0.0.1:0"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	addresses := server.Addresses()
+	if len(addresses) != 2 {
+		t.Fatal("Expected two addresses, found", addresses)
+	}
+	added := "http://" + addresses[1].String()
+	if _, body := get(t, added+"/"); body != "OK" {
+		t.Fatal("Unexpected body on the added address:", body)
+	}
+
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := http.Get(added + "/block")
+		blocked <- err
+	}()
+	<-entered
+	removed := make(chan error, 1)
+	go func() { removed <- server.RemoveAddress(addresses[1].String()) }()
+	select {
+	case err := <-removed:
+		t.Fatal("RemoveAddress returned before the request drained:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := net.Dial("tcp", addresses[1].String()); err == nil {
+		t.Fatal("Removed address still accepting connections")
+	}
+	if _, body := get(t, base+"/"); body != "OK" {
+		t.Fatal("Unexpected body on the primary address:", body)
+	}
+	close(release)
+	if err := <-blocked; err != nil {
+		t.Fatal("In-flight request failed:", err)
+	}
+	select {
+	case err := <-removed:
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RemoveAddress did not return after draining")
+	}
+	if addresses := server.Addresses(); len(addresses) != 1 {
+		t.Fatal("Expected only the primary address, found", addresses)
+	}
+	if err := server.RemoveAddress(addresses[0].String()); err == nil {
+		t.Fatal("Expected an error removing the primary address")
+	}
+	if err := server.RemoveAddress(addresses[1].String()); err == nil {
+		t.Fatal("Expected an error removing an address twice")
+	}
+}
+
+func TestAddAddressDuringStop(t *testing.T) {
+	binding := make(chan struct{})
+	release := make(chan struct{})
+	bound := make(chan net.Listener, 1)
+	server := New(writeString("OK"))
+	server.SetQuiet(true)
+	server.SetListenerFactory(func(address string) (net.Listener, error) {
+		if server.IsListening() {
+			close(binding)
+			<-release
+		}
+		listener, err := net.Listen("tcp", address)
+		if err == nil && server.Address() != nil {
+			bound <- listener
+		}
+		return listener, err
+	})
+	startServer(t, server)
+	added := make(chan error, 1)
+	go func() { added <- server.AddAddress("127.0.0.1:0") }()
+	<-binding
+	<-server.Stop()
+	close(release)
+	if err := <-added; err != ErrNotRunning {
+		t.Fatal("Expected ErrNotRunning, received", err)
+	}
+	if addresses := server.Addresses(); len(addresses) > 1 {
+		t.Fatal("Expected no added address, found", addresses)
+	}
+	if conn, err := net.Dial("tcp", (<-bound).Addr().String()); err == nil {
+		conn.Close()
+		t.Fatal("Address added during Stop is still accepting connections")
+	}
+}
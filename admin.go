@@ -0,0 +1,41 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// EnableAdminListener serves operational endpoints on a separate plain HTTP
+// address, keeping them off the Server's public handler. The listener shares
+// the Server's lifecycle like EnableChallengeListener. It serves:
+//
+//	/healthz  200 while the Server is running
+//	/readyz   200 while the readiness state is ReadinessReady, otherwise 503
+//	/stats    the Server's Stats as JSON
+//
+// The returned mux may be used to register further endpoints, such as the
+// net/http/pprof handlers, before Start. Endpoints like these expose internal
+// state, so address should normally be on localhost or an internal interface.
+func (s *Server) EnableAdminListener(address string) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(writer http.ResponseWriter, request *http.Request) {
+		state := s.Readiness()
+		if state != ReadinessReady {
+			if s.writeNotReady(writer) {
+				return
+			}
+			http.Error(writer, state.String(), http.StatusServiceUnavailable)
+			return
+		}
+		writer.Write([]byte(state.String() + "\n"))
+	})
+	mux.HandleFunc("/stats", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(s.Stats())
+	})
+	s.addCompanion("admin", address, mux)
+	return mux
+}
@@ -0,0 +1,45 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestAdminListener(t *testing.T) {
+	server := New(writeString("public"))
+	mux := server.EnableAdminListener("127.0.0.1:")
+	mux.HandleFunc("/custom", writeString("custom"))
+	base := startServer(t, server)
+	admin := "http://" + server.companion("admin").listener.Addr().String()
+	if response, _ := get(t, base+"/healthz"); response.StatusCode != http.StatusOK {
+		t.Fatal("Unexpected public response:", response.Status)
+	}
+	if _, body := get(t, base+"/healthz"); body != "public" {
+		t.Fatalf("Admin endpoint served on the public listener: %q", body)
+	}
+	if _, body := get(t, admin+"/healthz"); body != "ok\n" {
+		t.Fatalf("Unexpected health response %q", body)
+	}
+	if response, _ := get(t, admin+"/readyz"); response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal("Expected 503 before ready, received", response.Status)
+	}
+	server.SetReady(true)
+	if response, _ := get(t, admin+"/readyz"); response.StatusCode != http.StatusOK {
+		t.Fatal("Expected 200 once ready, received", response.Status)
+	}
+	_, body := get(t, admin+"/stats")
+	var stats ServerStats
+	if err := json.Unmarshal([]byte(body), &stats); err != nil || stats.TotalRequests != 2 {
+		t.Fatalf("Unexpected stats %q: %v", body, err)
+	}
+	if _, body := get(t, admin+"/custom"); body != "custom" {
+		t.Fatalf("Unexpected custom response %q", body)
+	}
+	address := server.companion("admin").listener.Addr().String()
+	<-server.Stop()
+	if _, err := net.Dial("tcp", address); err == nil {
+		t.Fatal("Expected the admin listener to be closed")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package httpserver
+
+import "net"
+
+func setListenBacklog(listener net.Listener, backlog int) error {
+	return errNoBacklog
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package httpserver
+
+import (
+	"net"
+	"syscall"
+)
+
+// setListenBacklog calls listen(2) again on the listener's socket, which on
+// most Unix systems replaces the backlog chosen by net.Listen.
+func setListenBacklog(listener net.Listener, backlog int) error {
+	conn, ok := listener.(syscall.Conn)
+	if !ok {
+		return errNoBacklog
+	}
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	if err := raw.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return listenErr
+}
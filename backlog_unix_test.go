@@ -0,0 +1,27 @@
+//go:build unix
+
+package httpserver
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestListenBacklog(t *testing.T) {
+	var buffer bytes.Buffer
+	server := New(writeString("OK"))
+	server.SetLogger(log.New(&buffer, "", 0))
+	server.SetListenBacklog(4096)
+	base := startServer(t, server)
+	if _, body := get(t, base+"/"); body != "OK" {
+		t.Fatalf("Unexpected body %q", body)
+	}
+	if strings.Contains(buffer.String(), "backlog") {
+		t.Fatalf("Failed to set backlog: %q", buffer.String())
+	}
+	if err := setListenBacklog(server.listener, 128); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+}
@@ -0,0 +1,121 @@
+package httpserver
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// EnableResponseBuffering buffers each response of up to maxBytes so that it
+// can be sent with a Content-Length header instead of chunked encoding, which
+// some clients handle better and which lets connections be reused more
+// reliably. The status and headers are held until the handler returns. A
+// response that grows past maxBytes, or that the handler flushes, is streamed
+// as usual from that point. Buffering delays the first byte of every
+// response, so it is off by default.
+func (s *Server) EnableResponseBuffering(maxBytes int) {
+	s.responseBuffer = maxBytes
+}
+
+// bufferingWriter holds a response until it completes or exceeds max bytes.
+type bufferingWriter struct {
+	http.ResponseWriter
+	max       int
+	head      bool
+	buffer    []byte
+	status    int
+	streaming bool
+}
+
+func bufferResponses(maxBytes int, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		buffered := &bufferingWriter{ResponseWriter: writer, max: maxBytes, head: request.Method == http.MethodHead}
+		handler.ServeHTTP(buffered, request)
+		buffered.finish()
+	})
+}
+
+func (w *bufferingWriter) WriteHeader(status int) {
+	if w.streaming {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status != 0 {
+		// As in net/http, the first status sent wins.
+		return
+	}
+	if status < 200 {
+		// Informational responses are sent immediately.
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *bufferingWriter) Write(p []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if len(w.buffer)+len(p) <= w.max {
+		w.buffer = append(w.buffer, p...)
+		return len(p), nil
+	}
+	if err := w.stream(); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// stream sends the held status and buffered bytes and passes all further
+// writes straight through.
+func (w *bufferingWriter) stream() error {
+	w.streaming = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buffer := w.buffer
+	w.buffer = nil
+	if len(buffer) > 0 {
+		_, err := w.ResponseWriter.Write(buffer)
+		return err
+	}
+	return nil
+}
+
+func (w *bufferingWriter) finish() {
+	if w.streaming {
+		return
+	}
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := w.Header()
+	if bodyAllowed(status) && header.Get("Content-Length") == "" && header.Get("Transfer-Encoding") == "" && (len(w.buffer) > 0 || !w.head) {
+		header.Set("Content-Length", strconv.Itoa(len(w.buffer)))
+	}
+	w.stream()
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+func (w *bufferingWriter) Flush() {
+	if !w.streaming {
+		w.stream()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *bufferingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *bufferingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,77 @@
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// SetTrustedProxies sets the proxies whose X-Forwarded-For and X-Real-IP
+// headers ClientIP believes. Each entry is a CIDR prefix such as
+// "10.0.0.0/8" or a single address. Headers from any other peer are ignored,
+// since a client can set them to anything.
+func (s *Server) SetTrustedProxies(cidrs ...string) error {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return fmt.Errorf("httpserver: invalid trusted proxy %q", cidr)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	s.trustedProxies = prefixes
+	return nil
+}
+
+func (s *Server) trusted(addr netip.Addr) bool {
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that made request. If the
+// immediate peer is a trusted proxy, X-Forwarded-For is read from right to
+// left and the first address that is not a trusted proxy is returned, falling
+// back to X-Real-IP when there is no X-Forwarded-For. Otherwise the peer's
+// own address is returned.
+func (s *Server) ClientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !s.trusted(peer.Unmap()) {
+		return host
+	}
+	client := peer.Unmap()
+	forwarded := request.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(request.Header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap().String()
+		}
+		return client.String()
+	}
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed hop cannot be attributed, so stop at the
+			// last proxy that could be.
+			break
+		}
+		client = addr.Unmap()
+		if !s.trusted(client) {
+			break
+		}
+	}
+	return client.String()
+}
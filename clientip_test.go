@@ -0,0 +1,51 @@
+package httpserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	server := New(nil)
+	if err := server.SetTrustedProxies("10.0.0.0/8", "192.0.2.1"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	for _, test := range []struct {
+		remote    string
+		forwarded []string
+		realIP    string
+		expected  string
+	}{
+		{"203.0.113.5:1234", nil, "", "203.0.113.5"},
+		// Headers from untrusted peers are ignored.
+		{"203.0.113.5:1234", []string{"198.51.100.7"}, "", "203.0.113.5"},
+		{"203.0.113.5:1234", nil, "198.51.100.7", "203.0.113.5"},
+		{"10.1.2.3:1234", []string{"198.51.100.7"}, "", "198.51.100.7"},
+		{"192.0.2.1:1234", nil, "198.51.100.7", "198.51.100.7"},
+		// Trusted hops are skipped from the right.
+		{"10.1.2.3:1234", []string{"198.51.100.7, 10.9.9.9"}, "", "198.51.100.7"},
+		{"10.1.2.3:1234", []string{"198.51.100.7", "10.9.9.9"}, "", "198.51.100.7"},
+		// A client cannot spoof its address by prepending to the header.
+		{"10.1.2.3:1234", []string{"1.2.3.4, 198.51.100.7"}, "", "198.51.100.7"},
+		// Everything is trusted: use the leftmost hop.
+		{"10.1.2.3:1234", []string{"10.4.4.4, 10.5.5.5"}, "", "10.4.4.4"},
+		// Malformed hops stop the walk at the last attributable proxy.
+		{"10.1.2.3:1234", []string{"198.51.100.7, garbage"}, "", "10.1.2.3"},
+		{"[::ffff:10.1.2.3]:1234", []string{"198.51.100.7"}, "", "198.51.100.7"},
+	} {
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.RemoteAddr = test.remote
+		for _, value := range test.forwarded {
+			request.Header.Add("X-Forwarded-For", value)
+		}
+		if test.realIP != "" {
+			request.Header.Set("X-Real-IP", test.realIP)
+		}
+		if ip := server.ClientIP(request); ip != test.expected {
+			t.Errorf("%s %v %q: expected %s, found %s", test.remote, test.forwarded, test.realIP, test.expected, ip)
+		}
+	}
+	if err := server.SetTrustedProxies("not-a-cidr"); err == nil {
+		t.Fatal("Expected an error for an invalid proxy")
+	}
+}
@@ -0,0 +1,103 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// companion is a plain HTTP listener that shares the Server's lifecycle.
+type companion struct {
+	name     string
+	address  string
+	handler  http.Handler
+	listener net.Listener
+	server   *http.Server
+}
+
+// EnableChallengeListener serves handler on a second, plain HTTP address for
+// as long as the Server runs. It is intended for the ACME HTTP-01 challenge
+// listener a TLS Server needs when using autocert, whose
+// Manager.HTTPHandler would be passed as handler. Start binds address and
+// fails if it cannot. On Stop the companion listener is drained alongside the
+// Server, and Wait is not released until both are down. Requests on it are
+// not allowed to extend shutdown: any still running when the Server has
+// drained are closed.
+func (s *Server) EnableChallengeListener(address string, handler http.Handler) {
+	s.addCompanion("challenge", address, handler)
+}
+
+// addCompanion registers a companion listener, replacing any previously
+// registered under the same name.
+func (s *Server) addCompanion(name, address string, handler http.Handler) {
+	c := &companion{name: name, address: address, handler: handler}
+	for i, existing := range s.companions {
+		if existing.name == name {
+			s.companions[i] = c
+			return
+		}
+	}
+	s.companions = append(s.companions, c)
+}
+
+func (s *Server) companion(name string) *companion {
+	for _, c := range s.companions {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// listenCompanions binds every companion listener, closing them all if any
+// fails.
+func (s *Server) listenCompanions() error {
+	for i, c := range s.companions {
+		listener, err := s.listen("tcp", c.address)
+		if err != nil {
+			for _, opened := range s.companions[:i] {
+				opened.listener.Close()
+			}
+			return err
+		}
+		c.listener = listener
+		c.server = &http.Server{Handler: c.handler, ErrorLog: s.errorLog()}
+	}
+	return nil
+}
+
+func (s *Server) serveCompanions() {
+	for _, c := range s.companions {
+		server, listener := c.server, c.listener
+		go func() {
+			if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+				s.setError(err)
+			}
+		}()
+		s.logf("Listening for %s requests on %s", c.name, listener.Addr())
+	}
+}
+
+// shutdownCompanions begins draining the companion listeners and returns a
+// function that closes them and waits for them to finish.
+func (s *Server) shutdownCompanions(ctx context.Context) (closeCompanions func()) {
+	var wg sync.WaitGroup
+	servers := make([]*http.Server, 0, len(s.companions))
+	for _, c := range s.companions {
+		server := c.server
+		servers = append(servers, server)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.Shutdown(ctx)
+		}()
+	}
+	return func() {
+		for _, server := range servers {
+			server.Close()
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,53 @@
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestChallengeListener(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	server := New(writeString("main"))
+	server.EnableChallengeListener("127.0.0.1:", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/block" {
+			entered <- struct{}{}
+			<-request.Context().Done()
+			return
+		}
+		writer.Write([]byte("challenge"))
+	}))
+	startServer(t, server)
+	address := server.companion("challenge").listener.Addr().String()
+	if _, body := get(t, "http://"+address+"/"); body != "challenge" {
+		t.Fatalf("Unexpected challenge response %q", body)
+	}
+	go http.Get("http://" + address + "/block")
+	<-entered
+	select {
+	case <-server.Stop():
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown waited on the challenge listener")
+	}
+	if _, err := net.Dial("tcp", address); err == nil {
+		t.Fatal("Expected the challenge listener to be closed")
+	}
+}
+
+func TestChallengeListenerBindError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer listener.Close()
+	server := New(writeString("main"))
+	server.EnableChallengeListener(listener.Addr().String(), http.NotFoundHandler())
+	if err := server.Start("127.0.0.1:"); err == nil {
+		<-server.Stop()
+		t.Fatal("Expected Start to fail when the challenge address is in use")
+	}
+	if server.IsListening() {
+		t.Fatal("Server should not be listening")
+	}
+}
@@ -0,0 +1,289 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// trackedConn holds the Server's state for a single connection. It is created
+// by http.Server.ConnContext and carried in the context of every request on
+// the connection.
+type trackedConn struct {
+	net.Conn
+	id       uint64
+	created  time.Time
+	requests atomic.Int64
+	reported bool
+	idle     atomic.Bool
+	stream   atomic.Bool
+	// origin is the added listener that accepted the connection, or nil for
+	// the primary listener.
+	origin *addedListener
+}
+
+func (s *Server) connContext(ctx context.Context, conn net.Conn) context.Context {
+	tracked := &trackedConn{Conn: conn, id: s.nextConnID.Add(1), created: time.Now()}
+	s.connsMutex.Lock()
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]*trackedConn)
+		s.connsByID = make(map[uint64]*trackedConn)
+	}
+	s.conns[conn] = tracked
+	s.connsByID[tracked.id] = tracked
+	raw := conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		raw = tlsConn.NetConn()
+	}
+	if origin, ok := s.connOrigins[raw]; ok {
+		delete(s.connOrigins, raw)
+		tracked.origin = origin
+		origin.conns.Add(1)
+	}
+	s.connsMutex.Unlock()
+	return context.WithValue(ctx, connKey, tracked)
+}
+
+func (s *Server) connState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		s.activeConns.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		s.activeConns.Add(-1)
+		s.connsMutex.Lock()
+		tracked, ok := s.conns[conn]
+		if ok {
+			delete(s.conns, conn)
+			delete(s.connsByID, tracked.id)
+		}
+		s.connsMutex.Unlock()
+		if ok && tracked.origin != nil && tracked.origin.conns.Add(-1) == 0 && tracked.origin.draining.Load() {
+			tracked.origin.drain()
+		}
+	case http.StateActive:
+		if tracked := s.trackedConn(conn); tracked != nil {
+			tracked.idle.Store(false)
+		}
+		if s.connectionHandler != nil {
+			s.reportConnection(conn)
+		}
+	case http.StateIdle:
+		if tracked := s.trackedConn(conn); tracked != nil {
+			tracked.idle.Store(true)
+			if tracked.origin != nil && tracked.origin.draining.Load() {
+				conn.Close()
+			}
+		}
+	}
+}
+
+func (s *Server) trackedConn(conn net.Conn) *trackedConn {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	return s.conns[conn]
+}
+
+// ConnIDFromContext returns the ID of the connection a request arrived on, for
+// use with CloseConnection. IDs are unique for the lifetime of the Server and
+// are never reused, even when a client reconnects from the same address.
+func ConnIDFromContext(ctx context.Context) (uint64, bool) {
+	if conn := connFromContext(ctx); conn != nil {
+		return conn.id, true
+	}
+	return 0, false
+}
+
+// CloseConnection immediately closes the connection with the given ID,
+// interrupting any requests in progress on it, such as to cut off a
+// misbehaving client. It reports whether the connection was open. Hijacked
+// connections are no longer tracked and cannot be closed this way.
+func (s *Server) CloseConnection(id uint64) bool {
+	s.connsMutex.Lock()
+	tracked, ok := s.connsByID[id]
+	s.connsMutex.Unlock()
+	if !ok {
+		return false
+	}
+	tracked.Close()
+	return true
+}
+
+// MarkStream classifies the connection a request arrived on as a streaming
+// connection, such as one serving Server-Sent Events or a long poll, so that
+// it is given the stream drain deadline set by SetDrainDeadlines rather than
+// the one for ordinary connections. Call it from the handler with the
+// request's context. The classification lasts for the life of the connection,
+// and on HTTP/2 applies to every request multiplexed on it. It reports whether
+// the context belonged to a request served by a Server.
+func MarkStream(ctx context.Context) bool {
+	conn := connFromContext(ctx)
+	if conn == nil {
+		return false
+	}
+	conn.stream.Store(true)
+	return true
+}
+
+// closeConnsByClass closes every tracked connection of the given class.
+func (s *Server) closeConnsByClass(stream bool) {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	for _, tracked := range s.conns {
+		if tracked.stream.Load() == stream {
+			tracked.Close()
+		}
+	}
+}
+
+// ConnInfo describes an established client connection.
+type ConnInfo struct {
+	// ID identifies the connection for CloseConnection.
+	ID         uint64
+	RemoteAddr net.Addr
+	LocalAddr  net.Addr
+	// TLS reports whether the connection is encrypted. The remaining fields
+	// are only set for TLS connections.
+	TLS bool
+	// Protocol is the protocol negotiated with ALPN, such as "h2", or empty
+	// if the client did not use ALPN.
+	Protocol    string
+	TLSVersion  uint16
+	CipherSuite uint16
+}
+
+// SetConnectionHandler sets a function that is called once for each client
+// connection when it is established, after the TLS handshake if any, and
+// before its first request is handled. It is called on the connection's
+// goroutine, so it should return quickly.
+func (s *Server) SetConnectionHandler(handler func(ConnInfo)) {
+	s.connectionHandler = handler
+}
+
+func (s *Server) reportConnection(conn net.Conn) {
+	s.connsMutex.Lock()
+	tracked, ok := s.conns[conn]
+	if !ok || tracked.reported {
+		s.connsMutex.Unlock()
+		return
+	}
+	tracked.reported = true
+	s.connsMutex.Unlock()
+	info := ConnInfo{ID: tracked.id, RemoteAddr: conn.RemoteAddr(), LocalAddr: conn.LocalAddr()}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		info.TLS = true
+		info.Protocol = state.NegotiatedProtocol
+		info.TLSVersion = state.Version
+		info.CipherSuite = state.CipherSuite
+	}
+	s.connectionHandler(info)
+}
+
+func connFromContext(ctx context.Context) *trackedConn {
+	conn, _ := ctx.Value(connKey).(*trackedConn)
+	return conn
+}
+
+// SetConnMaxLifetime closes connections once they are older than lifetime,
+// after the request in progress completes, by responding with
+// Connection: close. Forcing clients to reconnect periodically helps a load
+// balancer spread long-lived clients across instances after scaling. Zero,
+// the default, means connections may live indefinitely.
+func (s *Server) SetConnMaxLifetime(lifetime time.Duration) {
+	s.connMaxLifetime = lifetime
+}
+
+func limitConnLifetime(lifetime time.Duration, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if conn := connFromContext(request.Context()); conn != nil && time.Since(conn.created) >= lifetime {
+			writer.Header().Set("Connection", "close")
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// SetMaxRequestDuration bounds how long any single request may take, from when
+// its handler starts until it returns, regardless of activity. Unlike the
+// write and idle timeouts it also cuts off streaming responses that keep
+// writing. When the limit passes, the request's context is cancelled and its
+// connection is closed, which also ends any other requests multiplexed on an
+// HTTP/2 connection. Zero, the default, means no limit.
+func (s *Server) SetMaxRequestDuration(d time.Duration) {
+	s.maxRequestDuration = d
+}
+
+type routeTimeout struct {
+	prefix   string
+	duration time.Duration
+}
+
+// SetRouteTimeout overrides the limit set by SetMaxRequestDuration for
+// requests whose path begins with pathPrefix, so that an endpoint that
+// legitimately takes longer, such as report generation, can have its own
+// deadline. Where several prefixes match, the longest wins, and other requests
+// use the Server-wide limit. Zero means no limit for the route. Setting a
+// prefix again replaces its duration. It must be called before Start.
+func (s *Server) SetRouteTimeout(pathPrefix string, d time.Duration) {
+	for i, route := range s.routeTimeouts {
+		if route.prefix == pathPrefix {
+			s.routeTimeouts[i].duration = d
+			return
+		}
+	}
+	s.routeTimeouts = append(s.routeTimeouts, routeTimeout{prefix: pathPrefix, duration: d})
+}
+
+// requestDuration returns the limit for a request path: that of the longest
+// matching route, or d.
+func requestDuration(d time.Duration, routes []routeTimeout, path string) time.Duration {
+	matched := -1
+	for _, route := range routes {
+		if len(route.prefix) > matched && strings.HasPrefix(path, route.prefix) {
+			matched, d = len(route.prefix), route.duration
+		}
+	}
+	return d
+}
+
+func limitRequestDuration(d time.Duration, routes []routeTimeout, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		limit := requestDuration(d, routes, request.URL.Path)
+		if limit <= 0 {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		ctx, cancel := context.WithCancel(request.Context())
+		defer cancel()
+		conn := connFromContext(ctx)
+		timer := time.AfterFunc(limit, func() {
+			cancel()
+			if conn != nil {
+				conn.Close()
+			}
+		})
+		defer timer.Stop()
+		handler.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// SetMaxRequestsPerConn closes each connection after it has served n
+// requests, by responding to the nth with Connection: close. Like
+// SetConnMaxLifetime it recycles long-lived connections, which helps with
+// misbehaving clients and rebalancing load. Zero, the default, means no
+// limit.
+func (s *Server) SetMaxRequestsPerConn(n int) {
+	s.maxRequestsPerConn = n
+}
+
+func limitConnRequests(n int, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if conn := connFromContext(request.Context()); conn != nil && conn.requests.Add(1) >= int64(n) {
+			writer.Header().Set("Connection", "close")
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
@@ -0,0 +1,174 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConnMaxLifetime(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(request.RemoteAddr))
+	})
+	server.SetConnMaxLifetime(100 * time.Millisecond)
+	base := startServer(t, server)
+	response, first := get(t, base+"/")
+	if response.Close {
+		t.Fatal("Young connection closed")
+	}
+	if response, second := get(t, base+"/"); response.Close || second != first {
+		t.Fatal("Expected the connection to be reused")
+	}
+	time.Sleep(150 * time.Millisecond)
+	response, old := get(t, base+"/")
+	if !response.Close || old != first {
+		t.Fatal("Expected the old connection to be closed after its lifetime")
+	}
+	if _, next := get(t, base+"/"); next == first {
+		t.Fatal("Expected a new connection after the lifetime expired")
+	}
+}
+
+func TestMaxRequestsPerConn(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(request.RemoteAddr))
+	})
+	server.SetMaxRequestsPerConn(3)
+	base := startServer(t, server)
+	_, first := get(t, base+"/")
+	for i := 2; i <= 3; i++ {
+		response, addr := get(t, base+"/")
+		if addr != first {
+			t.Fatalf("Expected request %d to reuse the connection", i)
+		}
+		if response.Close != (i == 3) {
+			t.Fatalf("Unexpected Connection: close on request %d", i)
+		}
+	}
+	if response, next := get(t, base+"/"); next == first || response.Close {
+		t.Fatal("Expected a fresh connection after 3 requests")
+	}
+}
+
+func TestCloseConnection(t *testing.T) {
+	ids := make(chan uint64, 1)
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		id, _ := ConnIDFromContext(request.Context())
+		ids <- id
+		<-request.Context().Done()
+	})
+	base := startServer(t, server)
+	conn, err := net.Dial("tcp", base[len("http://"):])
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n")
+	id := <-ids
+	if server.CloseConnection(id + 1) {
+		t.Fatal("Closed a connection that does not exist")
+	}
+	// A second connection from the same client must not be affected.
+	other, err := net.Dial("tcp", base[len("http://"):])
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer other.Close()
+	fmt.Fprint(other, "GET / HTTP/1.1\r\nHost: test\r\n\r\n")
+	otherID := <-ids
+	if !server.CloseConnection(id) {
+		t.Fatal("Expected the connection to be open")
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Fatal("Expected the connection to be closed, received", err)
+	}
+	other.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	var buffer [1]byte
+	if _, err := other.Read(buffer[:]); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("Expected the other connection to stay open, read returned", err)
+	}
+	if server.CloseConnection(id) {
+		t.Fatal("Closed connection should no longer be tracked")
+	}
+	server.CloseConnection(otherID)
+}
+
+func TestRouteTimeout(t *testing.T) {
+	elapsed := make(chan time.Duration, 1)
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		select {
+		case <-request.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		elapsed <- time.Since(start)
+	})
+	server.SetMaxRequestDuration(600 * time.Millisecond)
+	server.SetRouteTimeout("/quick", 50*time.Millisecond)
+	server.SetRouteTimeout("/reports", 300*time.Millisecond)
+	server.SetRouteTimeout("/reports/summary", 50*time.Millisecond)
+	base := startServer(t, server)
+	for _, test := range []struct {
+		path     string
+		min, max time.Duration
+	}{
+		{"/quick", 50 * time.Millisecond, 300 * time.Millisecond},
+		{"/reports/monthly", 300 * time.Millisecond, 550 * time.Millisecond},
+		{"/reports/summary", 50 * time.Millisecond, 300 * time.Millisecond},
+		{"/other", 600 * time.Millisecond, 1200 * time.Millisecond},
+	} {
+		if response, err := http.Get(base + test.path); err == nil {
+			response.Body.Close()
+		}
+		if d := <-elapsed; d < test.min || d > test.max {
+			t.Errorf("Expected %s to be cut off after %s to %s, took %s", test.path, test.min, test.max, d)
+		}
+	}
+}
+
+func TestMaxRequestDuration(t *testing.T) {
+	cancelled := make(chan bool, 1)
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/fast" {
+			return
+		}
+		for {
+			writer.Write([]byte("."))
+			writer.(http.Flusher).Flush()
+			select {
+			case <-request.Context().Done():
+				cancelled <- true
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	})
+	server.SetMaxRequestDuration(100 * time.Millisecond)
+	base := startServer(t, server)
+	if response, _ := get(t, base+"/fast"); response.StatusCode != http.StatusOK {
+		t.Fatal("Unexpected response", response.Status)
+	}
+	start := time.Now()
+	response, err := http.Get(base + "/stream")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer response.Body.Close()
+	if _, err := ioutil.ReadAll(response.Body); err == nil {
+		t.Fatal("Expected the stream to be cut off")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatal("Request took", elapsed)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Request context not cancelled")
+	}
+}
@@ -0,0 +1,100 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+)
+
+// contextKey is the type of the keys the Server uses for values it adds to
+// request contexts. Values are read with the exported accessors below rather
+// than with the keys directly.
+type contextKey int
+
+const (
+	serverAddrKey contextKey = iota
+	requestIDKey
+	connKey
+	startTimeKey
+	serverKey
+)
+
+// ServerView is the read-only view of a Server available to its handlers
+// through ServerFromContext. It leaves out the methods that configure, start
+// or stop the Server, which are unsafe or meaningless from a handler.
+type ServerView interface {
+	Address() net.Addr
+	IsTLS() bool
+	HTTP2Enabled() bool
+	Uptime() time.Duration
+	InFlight() int
+	Stats() ServerStats
+	Readiness() ReadinessState
+	LastError() error
+}
+
+// ServerFromContext returns the Server handling the request, so that handlers
+// such as a status endpoint can describe it without a global variable. It is
+// set on every request served by a Server.
+func ServerFromContext(ctx context.Context) (ServerView, bool) {
+	s, ok := ctx.Value(serverKey).(*Server)
+	if !ok {
+		return nil, false
+	}
+	return s, true
+}
+
+// ServerAddrFromContext returns the address of the Server listener that
+// accepted the request. It is set on every request served by a Server.
+func ServerAddrFromContext(ctx context.Context) (net.Addr, bool) {
+	addr, ok := ctx.Value(serverAddrKey).(net.Addr)
+	return addr, ok
+}
+
+// StartTimeFromContext returns the time the Server handling the request was
+// started. It is set on every request served by a Server.
+func StartTimeFromContext(ctx context.Context) (time.Time, bool) {
+	start, ok := ctx.Value(startTimeKey).(time.Time)
+	return start, ok
+}
+
+// RequestIDFromContext returns the ID assigned to the request. It is set when
+// request IDs are enabled with EnableRequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok
+}
+
+// maxRequestIDLength bounds the length of request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// EnableRequestID assigns an ID to every request, available to handlers with
+// RequestIDFromContext and echoed in the named response header. An ID sent by
+// the client in the same header is used if present, otherwise a random one is
+// generated. The header defaults to X-Request-ID.
+func (s *Server) EnableRequestID(header string) {
+	if header == "" {
+		header = "X-Request-ID"
+	}
+	s.requestIDHeader = header
+}
+
+func newRequestID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+func assignRequestIDs(header string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(header)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		writer.Header().Set(header, id)
+		handler.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), requestIDKey, id)))
+	})
+}
@@ -0,0 +1,134 @@
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestContextValues(t *testing.T) {
+	var server *Server
+	server = New(func(writer http.ResponseWriter, request *http.Request) {
+		addr, ok := ServerAddrFromContext(request.Context())
+		if !ok || addr.String() != server.Address().String() {
+			t.Errorf("Unexpected server address %v", addr)
+		}
+		id, _ := RequestIDFromContext(request.Context())
+		writer.Write([]byte(id))
+	})
+	server.EnableRequestID("")
+	base := startServer(t, server)
+	response, body := get(t, base+"/")
+	if len(body) != 16 || response.Header.Get("X-Request-ID") != body {
+		t.Fatalf("Unexpected generated request ID %q, header %q", body, response.Header.Get("X-Request-ID"))
+	}
+	request, _ := http.NewRequest("GET", base+"/", nil)
+	request.Header.Set("X-Request-ID", "client-id")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	response.Body.Close()
+	if id := response.Header.Get("X-Request-ID"); id != "client-id" {
+		t.Fatal("Expected client request ID to be used, received", id)
+	}
+}
+
+func TestContextValuesUnset(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		_, ok := RequestIDFromContext(request.Context())
+		writer.Write([]byte(fmt.Sprint(ok)))
+	})
+	base := startServer(t, server)
+	if _, body := get(t, base+"/"); body != "false" {
+		t.Fatal("Request ID set without EnableRequestID")
+	}
+}
+
+func TestUptime(t *testing.T) {
+	var server *Server
+	server = New(func(writer http.ResponseWriter, request *http.Request) {
+		uptime := server.Uptime()
+		start, ok := StartTimeFromContext(request.Context())
+		if !ok || time.Since(start) < uptime {
+			t.Errorf("Unexpected start time %v", start)
+		}
+	})
+	if server.Uptime() != 0 {
+		t.Fatal("Expected zero uptime before Start, found", server.Uptime())
+	}
+	base := startServer(t, server)
+	get(t, base+"/")
+	<-server.Stop()
+	uptime := server.Uptime()
+	if uptime <= 0 {
+		t.Fatal("Expected positive uptime, found", uptime)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if server.Uptime() != uptime {
+		t.Fatal("Uptime advanced after Stop:", uptime, server.Uptime())
+	}
+}
+
+func TestDeadlineHeader(t *testing.T) {
+	for _, test := range []struct {
+		header, value string
+		expected      time.Duration
+	}{
+		{"", "", 0},
+		{"", "250ms", 250 * time.Millisecond},
+		{"", "2s", 2 * time.Second},
+		{"", "invalid", 0},
+		{"", "-1s", 0},
+		{"grpc-timeout", "250m", 250 * time.Millisecond},
+		{"grpc-timeout", "3S", 3 * time.Second},
+		{"grpc-timeout", "2s", 0},
+		{"grpc-timeout", "123456789S", 0},
+	} {
+		server := New(func(writer http.ResponseWriter, request *http.Request) {
+			deadline, ok := request.Context().Deadline()
+			if !ok {
+				return
+			}
+			fmt.Fprint(writer, time.Until(deadline).Round(50*time.Millisecond))
+		})
+		server.EnableDeadlineHeader(test.header)
+		base := startServer(t, server)
+		request, _ := http.NewRequest("GET", base+"/", nil)
+		header := test.header
+		if header == "" {
+			header = "X-Request-Deadline"
+		}
+		if test.value != "" {
+			request.Header.Set(header, test.value)
+		}
+		_, body := post(t, request)
+		expected := ""
+		if test.expected > 0 {
+			expected = test.expected.String()
+		}
+		if body != expected {
+			t.Errorf("%s: %q: expected deadline %q, found %q", header, test.value, expected, body)
+		}
+	}
+}
+
+func TestServerFromContext(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		view, ok := ServerFromContext(request.Context())
+		if !ok {
+			t.Error("Server not set on the request context")
+			return
+		}
+		fmt.Fprint(writer, view.Uptime() > 0, view.InFlight())
+	})
+	base := startServer(t, server)
+	if _, body := get(t, base+"/"); body != "true 1" {
+		t.Fatalf("Unexpected view of the server %q", body)
+	}
+	if view, ok := ServerFromContext(context.Background()); ok || view != nil {
+		t.Fatalf("Server %v found on a context it was never added to", view)
+	}
+}
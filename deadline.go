@@ -0,0 +1,69 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnableDeadlineHeader applies the time budget a caller sends in the named
+// request header as the deadline of the request's context, so that handlers
+// and the calls they make downstream stop when the caller gives up. If
+// headerName is empty, X-Request-Deadline is used. The value is a Go duration
+// such as "250ms" or "1.5s", except for the grpc-timeout header, which uses
+// gRPC's format such as "250m" for 250 milliseconds. Missing, malformed and
+// non-positive values are ignored and the request has no deadline.
+func (s *Server) EnableDeadlineHeader(headerName string) {
+	if headerName == "" {
+		headerName = "X-Request-Deadline"
+	}
+	s.deadlineHeader = headerName
+}
+
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout parses a grpc-timeout value: up to eight digits followed by
+// a unit.
+func parseGRPCTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+func applyDeadlines(headerName string, handler http.Handler) http.Handler {
+	grpc := strings.EqualFold(headerName, "grpc-timeout")
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		value := strings.TrimSpace(request.Header.Get(headerName))
+		var timeout time.Duration
+		var ok bool
+		if grpc {
+			timeout, ok = parseGRPCTimeout(value)
+		} else if parsed, err := time.ParseDuration(value); err == nil {
+			timeout, ok = parsed, true
+		}
+		if ok && timeout > 0 {
+			ctx, cancel := context.WithTimeout(request.Context(), timeout)
+			defer cancel()
+			request = request.WithContext(ctx)
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
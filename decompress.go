@@ -0,0 +1,89 @@
+package httpserver
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultDecompressedBytes limits decompressed request bodies when neither
+// EnableRequestDecompression nor SetMaxBodyBytes sets a limit.
+const defaultDecompressedBytes = 10 << 20
+
+// EnableRequestDecompression decodes request bodies sent with a gzip or
+// deflate Content-Encoding before the Server's handler reads them, removing
+// the Content-Encoding and Content-Length headers. The decompressed body is
+// limited to maxBytes, or to the limit set by SetMaxBodyBytes if maxBytes is
+// zero, or to 10 MB if neither is set, so that a small compressed body cannot
+// expand without bound; reads past the limit behave as with SetMaxBodyBytes.
+// Requests using any other encoding, including br, which the standard library
+// cannot decode, receive 415 Unsupported Media Type, and bodies that fail to
+// start decoding receive 400 Bad Request.
+func (s *Server) EnableRequestDecompression(maxBytes int64) {
+	s.decompressRequests = true
+	s.maxDecompressedBytes = maxBytes
+}
+
+// decodedBody reads a decompressed body, closing both the decompressor and
+// the original body.
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var err error
+	for _, closer := range b.closers {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func decompressRequests(n int64, respond ErrorResponder, handler http.Handler) http.Handler {
+	limited := limitBody(n, respond, handler)
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		encoding := request.Header.Get("Content-Encoding")
+		if encoding == "" || request.Body == nil || request.Body == http.NoBody {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		body := &decodedBody{Reader: request.Body, closers: []io.Closer{request.Body}}
+		codings := strings.Split(encoding, ",")
+		// Codings are listed in the order they were applied.
+		for i := len(codings) - 1; i >= 0; i-- {
+			var decoder io.ReadCloser
+			var err error
+			switch strings.ToLower(strings.TrimSpace(codings[i])) {
+			case "identity":
+				continue
+			case "gzip", "x-gzip":
+				decoder, err = gzip.NewReader(body.Reader)
+			case "deflate":
+				decoder, err = zlib.NewReader(body.Reader)
+			default:
+				body.Close()
+				respond(writer, http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType))
+				return
+			}
+			if err != nil {
+				body.Close()
+				respond(writer, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+				return
+			}
+			body.Reader = decoder
+			body.closers = append([]io.Closer{decoder}, body.closers...)
+		}
+		decoded := new(http.Request)
+		*decoded = *request
+		decoded.Header = request.Header.Clone()
+		decoded.Header.Del("Content-Encoding")
+		decoded.Header.Del("Content-Length")
+		decoded.ContentLength = -1
+		decoded.Body = body
+		limited.ServeHTTP(writer, decoded)
+	})
+}
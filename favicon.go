@@ -0,0 +1,56 @@
+package httpserver
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type favicon struct {
+	data        []byte
+	contentType string
+}
+
+// SetFavicon serves data as /favicon.ico, ahead of the Server's handler like
+// an intercept, so that browser requests for it neither reach the handler nor
+// fill logs with 404s. If data is nil, requests for it receive 204 No
+// Content. Like intercepts it must be set before Start; calling it again
+// replaces the icon.
+func (s *Server) SetFavicon(data []byte, contentType string) {
+	if s.favicon == nil {
+		s.Intercept("/favicon.ico", http.HandlerFunc(s.serveFavicon))
+	}
+	s.favicon = &favicon{data: data, contentType: contentType}
+}
+
+// SetFaviconFile is like SetFavicon, but reads the icon from the file at path
+// and takes its content type from the file's extension.
+func (s *Server) SetFaviconFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	s.SetFavicon(data, contentType)
+	return nil
+}
+
+func (s *Server) serveFavicon(writer http.ResponseWriter, request *http.Request) {
+	icon := s.favicon
+	if icon.data == nil {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	header := writer.Header()
+	header.Set("Content-Type", icon.contentType)
+	header.Set("Content-Length", strconv.Itoa(len(icon.data)))
+	header.Set("Cache-Control", "public, max-age=86400")
+	if request.Method != http.MethodHead {
+		writer.Write(icon.data)
+	}
+}
@@ -0,0 +1,137 @@
+package httpserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ETagStrategy selects how a file server validates cached responses.
+type ETagStrategy int
+
+const (
+	// ETagNone sends no ETag, leaving conditional requests to Last-Modified.
+	ETagNone ETagStrategy = iota
+	// ETagStrong sends a strong ETag derived from a hash of the file contents.
+	ETagStrong
+	// ETagWeak sends a weak ETag derived from a hash of the file contents.
+	ETagWeak
+)
+
+// FileOption configures a file server created by NewFileServer or
+// NewFSServer.
+type FileOption func(*fileServer)
+
+// WithETag sets how the file server generates ETags. Requests whose
+// If-None-Match matches the current ETag receive 304 Not Modified. Hashes are
+// cached until a file's size or modification time changes.
+func WithETag(strategy ETagStrategy) FileOption {
+	return func(f *fileServer) {
+		f.etag = strategy
+	}
+}
+
+// NewFileServer returns a Server that serves the files under dir in the way
+// http.FileServer does, including If-Modified-Since handling.
+func NewFileServer(dir string, options ...FileOption) *Server {
+	s := New(newFileServer(http.Dir(dir), options).ServeHTTP)
+	s.fileServer = true
+	return s
+}
+
+// NewFSServer is like NewFileServer, but serves the files in fsys, such as an
+// embed.FS bundling a tool's assets into its binary. It serves files as
+// http.FileServerFS does and accepts the same options.
+func NewFSServer(fsys fs.FS, options ...FileOption) *Server {
+	s := New(newFileServer(http.FS(fsys), options).ServeHTTP)
+	s.fileServer = true
+	return s
+}
+
+type fileHash struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+type fileServer struct {
+	fs     http.FileSystem
+	files  http.Handler
+	etag   ETagStrategy
+	mutex  sync.Mutex
+	hashes map[string]fileHash
+}
+
+func newFileServer(fs http.FileSystem, options []FileOption) *fileServer {
+	f := &fileServer{fs: fs, files: http.FileServer(fs), hashes: make(map[string]fileHash)}
+	for _, option := range options {
+		option(f)
+	}
+	return f
+}
+
+func (f *fileServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if f.etag != ETagNone {
+		if hash, ok := f.hash(request.URL.Path); ok {
+			tag := `"` + hash + `"`
+			if f.etag == ETagWeak {
+				tag = "W/" + tag
+			}
+			writer.Header().Set("ETag", tag)
+		}
+	}
+	f.files.ServeHTTP(writer, request)
+}
+
+// hash returns the content hash of the file that http.FileServer would serve
+// for urlPath, or false if it would not serve a file directly.
+func (f *fileServer) hash(urlPath string) (string, bool) {
+	if strings.HasSuffix(urlPath, "/index.html") {
+		return "", false
+	}
+	name := path.Clean("/" + urlPath)
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", false
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(urlPath, "/") {
+			return "", false
+		}
+		name = path.Join(name, "index.html")
+		file.Close()
+		if file, err = f.fs.Open(name); err != nil {
+			return "", false
+		}
+		defer file.Close()
+		if info, err = file.Stat(); err != nil || info.IsDir() {
+			return "", false
+		}
+	}
+	f.mutex.Lock()
+	cached, ok := f.hashes[name]
+	f.mutex.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.hash, true
+	}
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", false
+	}
+	hash := hex.EncodeToString(digest.Sum(nil)[:16])
+	f.mutex.Lock()
+	f.hashes[name] = fileHash{modTime: info.ModTime(), size: info.Size(), hash: hash}
+	f.mutex.Unlock()
+	return hash, true
+}
@@ -0,0 +1,85 @@
+package httpserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func conditionalGet(t *testing.T, url, etag string) *http.Response {
+	request, _ := http.NewRequest("GET", url, nil)
+	request.Header.Set("If-None-Match", etag)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	response.Body.Close()
+	return response
+}
+
+func TestFileServerETag(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, []byte("version 1"), 0o644); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	base := startServer(t, NewFileServer(dir, WithETag(ETagStrong)))
+	response, body := get(t, base+"/file.txt")
+	etag := response.Header.Get("ETag")
+	if body != "version 1" || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("Unexpected response %q with ETag %q", body, etag)
+	}
+	if response := conditionalGet(t, base+"/file.txt", etag); response.StatusCode != http.StatusNotModified {
+		t.Fatal("Expected 304, received", response.Status)
+	}
+	if err := os.WriteFile(file, []byte("version 2"), 0o644); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	os.Chtimes(file, time.Now(), time.Now().Add(time.Second))
+	if response := conditionalGet(t, base+"/file.txt", etag); response.StatusCode != http.StatusOK {
+		t.Fatal("Expected 200 after the file changed, received", response.Status)
+	}
+}
+
+func TestFileServerWeakETag(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("index"), 0o644); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	base := startServer(t, NewFileServer(dir, WithETag(ETagWeak)))
+	response, body := get(t, base+"/")
+	etag := response.Header.Get("ETag")
+	if body != "index" || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("Unexpected response %q with ETag %q", body, etag)
+	}
+	if response := conditionalGet(t, base+"/", etag); response.StatusCode != http.StatusNotModified {
+		t.Fatal("Expected 304, received", response.Status)
+	}
+}
+
+func TestFSServer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":     {Data: []byte("<h1>index</h1>")},
+		"static/app.js":  {Data: []byte("console.log(1)")},
+		"static/app.css": {Data: []byte("body{}")},
+	}
+	base := startServer(t, NewFSServer(fsys, WithETag(ETagWeak)))
+	if _, body := get(t, base+"/"); body != "<h1>index</h1>" {
+		t.Fatalf("Unexpected index %q", body)
+	}
+	response, body := get(t, base+"/static/app.js")
+	etag := response.Header.Get("ETag")
+	if body != "console.log(1)" || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("Unexpected response %q with ETag %q", body, etag)
+	}
+	if response := conditionalGet(t, base+"/static/app.js", etag); response.StatusCode != http.StatusNotModified {
+		t.Fatal("Expected 304, received", response.Status)
+	}
+	if response, _ := get(t, base+"/missing.txt"); response.StatusCode != http.StatusNotFound {
+		t.Fatal("Expected 404, received", response.Status)
+	}
+}
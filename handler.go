@@ -0,0 +1,260 @@
+package httpserver
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type intercept struct {
+	path    string
+	prefix  bool
+	handler http.Handler
+}
+
+func (i intercept) matches(path string) bool {
+	if i.prefix {
+		return strings.HasPrefix(path, i.path)
+	}
+	return path == i.path
+}
+
+// Intercept registers a handler that serves requests for exactly path instead
+// of the Server's handler. Intercepts are checked in the order they were
+// registered, and must be registered before Start.
+func (s *Server) Intercept(path string, handler http.Handler) {
+	s.intercepts = append(s.intercepts, intercept{path: path, handler: handler})
+}
+
+// InterceptPrefix is like Intercept, but matches every request path that
+// begins with prefix.
+func (s *Server) InterceptPrefix(prefix string, handler http.Handler) {
+	s.intercepts = append(s.intercepts, intercept{path: prefix, prefix: true, handler: handler})
+}
+
+// handler returns the http.Handler served by the Server: the Server's handler
+// and intercepts, wrapped in the middleware enabled on the Server.
+func (s *Server) handler() http.Handler {
+	respond := s.respondError
+	var handler http.Handler = http.HandlerFunc(s.serveHTTP)
+	if s.autoHead {
+		handler = autoHead(handler)
+	}
+	if s.responseBuffer > 0 {
+		handler = bufferResponses(s.responseBuffer, handler)
+	}
+	if s.pathNormalization != nil {
+		handler = normalizePaths(*s.pathNormalization, handler)
+	}
+	if s.disallowTrailers {
+		handler = dropTrailers(handler)
+	}
+	if s.decompressRequests {
+		limit := s.maxDecompressedBytes
+		if limit <= 0 {
+			limit = s.maxBodyBytes
+		}
+		if limit <= 0 {
+			limit = defaultDecompressedBytes
+		}
+		handler = decompressRequests(limit, respond, handler)
+	}
+	if s.maxBodyBytes > 0 {
+		handler = limitBody(s.maxBodyBytes, respond, handler)
+	}
+	if len(s.allowedMethods) > 0 {
+		handler = allowMethods(s.allowedMethods, s.passOptions, respond, handler)
+	}
+	if s.maxURLLength > 0 {
+		handler = limitURLLength(s.maxURLLength, respond, handler)
+	}
+	if s.maxRequestDuration > 0 || len(s.routeTimeouts) > 0 {
+		handler = limitRequestDuration(s.maxRequestDuration, slices.Clone(s.routeTimeouts), handler)
+	}
+	if s.connMaxLifetime > 0 {
+		handler = limitConnLifetime(s.connMaxLifetime, handler)
+	}
+	if s.maxRequestsPerConn > 0 {
+		handler = limitConnRequests(s.maxRequestsPerConn, handler)
+	}
+	if s.http10Policy != HTTP10Allow {
+		handler = applyHTTP10Policy(s.http10Policy, respond, handler)
+	}
+	if len(s.closePaths) > 0 {
+		handler = closeConnections(s.closePaths, handler)
+	}
+	if s.latencyShedder != nil {
+		handler = s.shedOnLatency(s.latencyShedder, respond, handler)
+	}
+	if s.defaultContentType != "" {
+		handler = setDefaultContentType(s.defaultContentType, handler)
+	}
+	headers := s.defaultHeaders
+	if s.noSniff {
+		headers = headers.Clone()
+		if headers == nil {
+			headers = make(http.Header)
+		}
+		headers.Set("X-Content-Type-Options", "nosniff")
+	}
+	if len(headers) > 0 || s.hsts != "" {
+		handler = addDefaultHeaders(headers, s.hsts, handler)
+	}
+	if s.instanceID != "" {
+		handler = setHeader("X-Served-By", s.instanceID, handler)
+	}
+	if s.deadlineHeader != "" {
+		handler = applyDeadlines(s.deadlineHeader, handler)
+	}
+	if s.requestIDHeader != "" {
+		handler = assignRequestIDs(s.requestIDHeader, handler)
+	}
+	if s.accessLog != nil {
+		handler = s.logAccess(handler)
+	}
+	if len(s.observers) > 0 {
+		handler = s.observeRequests(handler)
+	}
+	return s.countRequests(handler)
+}
+
+func (s *Server) countRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		s.totalRequests.Add(1)
+		s.inFlight.Add(1)
+		s.lastActivity.Store(time.Now().UnixNano())
+		defer func() {
+			s.lastActivity.Store(time.Now().UnixNano())
+			s.inFlight.Add(-1)
+		}()
+		if request.Body != nil && request.Body != http.NoBody {
+			request.Body = &countingBody{ReadCloser: request.Body, count: &s.bytesIn}
+		}
+		recorder := &responseWriter{ResponseWriter: writer}
+		defer func() {
+			s.bytesOut.Add(recorder.written)
+			s.countStatus(recorder.statusCode())
+		}()
+		handler.ServeHTTP(recorder, request)
+	})
+}
+
+// ErrorResponder writes an error response with the given status and message.
+type ErrorResponder func(writer http.ResponseWriter, status int, message string)
+
+// SetErrorResponder sets the function used to write the error responses the
+// Server generates itself, such as 405, 413, 414 and 503 responses from its
+// middleware, so that they can match an API's error format. The message is
+// the standard status text. By default errors are written with http.Error as
+// plain text.
+func (s *Server) SetErrorResponder(responder ErrorResponder) {
+	s.errorResponder = responder
+}
+
+func (s *Server) respondError(writer http.ResponseWriter, status int, message string) {
+	if s.errorResponder != nil {
+		s.errorResponder(writer, status, message)
+		return
+	}
+	http.Error(writer, message, status)
+}
+
+// SetNotFoundHandler sets the handler for requests that nothing routes, so
+// that they receive a consistent 404 page or error body. It serves requests
+// that match no intercept when the Server has no handler, requests that match
+// no pattern on the ServeMux of a Server created by NewMux, and requests for
+// missing files on a file server. Every other handler is left to answer
+// unrouted requests itself. When unset, the default, unrouted requests are
+// answered by the Server's handler.
+func (s *Server) SetNotFoundHandler(handler http.Handler) {
+	s.notFoundHandler = handler
+}
+
+func (s *Server) serveHTTP(writer http.ResponseWriter, request *http.Request) {
+	for _, i := range s.intercepts {
+		if i.matches(request.URL.Path) {
+			i.handler.ServeHTTP(writer, request)
+			return
+		}
+	}
+	if handler, ok := s.maintenanceHandler(request); ok {
+		handler.ServeHTTP(writer, request)
+		return
+	}
+	if s.startupHandler != nil && s.Readiness() == ReadinessStarting {
+		s.startupHandler.ServeHTTP(writer, request)
+		return
+	}
+	if s.notFoundHandler != nil {
+		s.serveRouted(writer, request)
+		return
+	}
+	handler, _, _ := s.routes()
+	handler(writer, request)
+}
+
+// serveRouted serves a request with the Server's handler, falling back to the
+// not found handler when the handler does not route it.
+func (s *Server) serveRouted(writer http.ResponseWriter, request *http.Request) {
+	handler, mux, fileServer := s.routes()
+	if handler == nil {
+		s.notFoundHandler.ServeHTTP(writer, request)
+		return
+	}
+	if mux != nil {
+		if _, pattern := mux.Handler(request); pattern != "" {
+			handler(writer, request)
+			return
+		}
+	} else if !fileServer {
+		handler(writer, request)
+		return
+	}
+	// An unmatched request is answered with either 404 or, when only the
+	// method differs, 405, so only a 404 is replaced.
+	recorder := &notFoundWriter{ResponseWriter: writer, header: writer.Header().Clone()}
+	handler(recorder, request)
+	if recorder.notFound {
+		s.notFoundHandler.ServeHTTP(writer, request)
+	}
+}
+
+// notFoundWriter discards a 404 response so that it can be replaced, putting
+// back the headers set before the handler was called.
+type notFoundWriter struct {
+	http.ResponseWriter
+	header   http.Header
+	wrote    bool
+	notFound bool
+}
+
+func (w *notFoundWriter) WriteHeader(status int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	if status == http.StatusNotFound {
+		w.notFound = true
+		header := w.Header()
+		clear(header)
+		maps.Copy(header, w.header)
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *notFoundWriter) Write(p []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.notFound {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *notFoundWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,199 @@
+package httpserver
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func get(t *testing.T, url string) (*http.Response, string) {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	return response, string(body)
+}
+
+func startServer(t *testing.T, server *Server) string {
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	t.Cleanup(func() {
+		if server.IsListening() {
+			<-server.Stop()
+		}
+	})
+	<-server.WaitForStart()
+	return fmt.Sprintf("http://%s", server.Address())
+}
+
+func writeString(body string) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(body))
+	}
+}
+
+func TestIntercept(t *testing.T) {
+	server := New(writeString("main"))
+	server.Intercept("/version", writeString("version"))
+	server.InterceptPrefix("/static/", writeString("static"))
+	server.Intercept("/static/exact", writeString("exact"))
+	base := startServer(t, server)
+	for path, expected := range map[string]string{
+		"/":              "main",
+		"/version":       "version",
+		"/version/extra": "main",
+		"/static/file":   "static",
+		"/static/exact":  "static",
+	} {
+		if _, body := get(t, base+path); body != expected {
+			t.Fatalf("Expected %q for %s, received %q", expected, path, body)
+		}
+	}
+}
+
+func TestNewMux(t *testing.T) {
+	server := NewMux()
+	server.HandleFunc("/hello", writeString("hello"))
+	server.Handle("/world/", writeString("world"))
+	base := startServer(t, server)
+	if _, body := get(t, base+"/hello"); body != "hello" {
+		t.Fatal("Unexpected body:", body)
+	}
+	if _, body := get(t, base+"/world/wide"); body != "world" {
+		t.Fatal("Unexpected body:", body)
+	}
+	if response, _ := get(t, base+"/missing"); response.StatusCode != http.StatusNotFound {
+		t.Fatal("Expected 404, received", response.Status)
+	}
+}
+
+func TestErrorResponder(t *testing.T) {
+	server := New(writeString("OK"))
+	server.SetAllowedMethods(http.MethodGet)
+	server.SetMaxURLLength(32)
+	server.SetStartupHandler(nil)
+	server.SetErrorResponder(func(writer http.ResponseWriter, status int, message string) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(status)
+		fmt.Fprintf(writer, `{"error":%q}`, message)
+	})
+	base := startServer(t, server)
+	for _, test := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodPost, "/", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/" + strings.Repeat("a", 64), http.StatusRequestURITooLong},
+		{http.MethodGet, "/", http.StatusServiceUnavailable},
+	} {
+		request, _ := http.NewRequest(test.method, base+test.path, nil)
+		response, body := post(t, request)
+		expected := fmt.Sprintf(`{"error":%q}`, http.StatusText(test.status))
+		if response.StatusCode != test.status || body != expected || response.Header.Get("Content-Type") != "application/json" {
+			t.Fatalf("Expected %d %s, received %s %s", test.status, expected, response.Status, body)
+		}
+	}
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	notFound := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(writer, `{"error":"not found"}`)
+	})
+	mux := NewMux()
+	mux.HandleFunc("/hello", writeString("hello"))
+	mux.HandleFunc("/gone", func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, "gone", http.StatusNotFound)
+	})
+	mux.SetNotFoundHandler(notFound)
+	mux.DisableContentSniffing()
+	mux.AddDefaultHeader("X-Frame-Options", "DENY")
+	base := startServer(t, mux)
+	for _, test := range []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/hello", http.StatusOK, "hello"},
+		{"GET", "/missing", http.StatusNotFound, `{"error":"not found"}`},
+		{"GET", "/gone", http.StatusNotFound, "gone\n"},
+	} {
+		request, _ := http.NewRequest(test.method, base+test.path, nil)
+		response, body := post(t, request)
+		if response.StatusCode != test.status || body != test.body {
+			t.Errorf("%s %s: expected %d %q, received %d %q", test.method, test.path, test.status, test.body, response.StatusCode, body)
+		}
+		if response.Header.Get("X-Content-Type-Options") != "nosniff" || response.Header.Get("X-Frame-Options") != "DENY" {
+			t.Errorf("%s %s: expected the default headers, received %v", test.method, test.path, response.Header)
+		}
+	}
+
+	intercepted := New(nil)
+	intercepted.Intercept("/version", writeString("version"))
+	intercepted.SetNotFoundHandler(notFound)
+	base = startServer(t, intercepted)
+	if _, body := get(t, base+"/version"); body != "version" {
+		t.Fatal("Unexpected body:", body)
+	}
+	if response, body := get(t, base+"/other"); response.StatusCode != http.StatusNotFound || response.Header.Get("Content-Type") != "application/json" || body != `{"error":"not found"}` {
+		t.Fatalf("Unexpected response %s %q", response.Status, body)
+	}
+
+	files := NewFSServer(fstest.MapFS{"index.html": {Data: []byte("index")}})
+	files.SetNotFoundHandler(notFound)
+	base = startServer(t, files)
+	if _, body := get(t, base+"/"); body != "index" {
+		t.Fatal("Unexpected body:", body)
+	}
+	if response, body := get(t, base+"/missing.txt"); response.StatusCode != http.StatusNotFound || body != `{"error":"not found"}` {
+		t.Fatalf("Unexpected response %s %q", response.Status, body)
+	}
+
+	custom := New(writeString("main"))
+	custom.SetNotFoundHandler(notFound)
+	base = startServer(t, custom)
+	if _, body := get(t, base+"/missing"); body != "main" {
+		t.Fatal("Unexpected body:", body)
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	server := New(writeString("main"))
+	server.SetFavicon(nil, "")
+	base := startServer(t, server)
+	if response, body := get(t, base+"/favicon.ico"); response.StatusCode != http.StatusNoContent || body != "" {
+		t.Fatalf("Expected 204, received %s %q", response.Status, body)
+	}
+	<-server.Stop()
+
+	path := filepath.Join(t.TempDir(), "favicon.png")
+	if err := os.WriteFile(path, []byte("\x89PNG icon"), 0644); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := server.SetFaviconFile(path); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	base = startServer(t, server)
+	response, body := get(t, base+"/favicon.ico")
+	if body != "\x89PNG icon" || response.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("Unexpected favicon %q of type %q", body, response.Header.Get("Content-Type"))
+	}
+	if _, body := get(t, base+"/"); body != "main" {
+		t.Fatal("Unexpected body:", body)
+	}
+	if err := server.SetFaviconFile(filepath.Join(t.TempDir(), "missing.ico")); err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,95 @@
+package httpserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// EnableAutoHead makes HEAD requests served by handlers written for GET
+// return the headers a GET would, including its Content-Length, without a
+// body. net/http already discards bodies written in response to HEAD, but
+// only reports their length when they are small, so the Server counts the
+// discarded body and sends the headers once the handler returns. Handlers
+// that set Content-Length themselves keep their value. Flushing is ignored for
+// HEAD requests.
+func (s *Server) EnableAutoHead() {
+	s.autoHead = true
+}
+
+func autoHead(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodHead {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		head := &headWriter{ResponseWriter: writer}
+		handler.ServeHTTP(head, request)
+		head.finish()
+	})
+}
+
+// headWriter discards the body of a response to a HEAD request, holding the
+// status until the handler returns so that the length of the discarded body
+// can be sent as its Content-Length.
+type headWriter struct {
+	http.ResponseWriter
+	status   int
+	written  int64
+	hijacked bool
+}
+
+func (w *headWriter) WriteHeader(status int) {
+	if status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.written += int64(len(p))
+	return len(p), nil
+}
+
+func (w *headWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := io.Copy(io.Discard, r)
+	w.written += n
+	return n, err
+}
+
+func (w *headWriter) Flush() {}
+
+func (w *headWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *headWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *headWriter) finish() {
+	if w.hijacked {
+		return
+	}
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := w.Header()
+	if _, ok := header["Content-Length"]; !ok && w.written > 0 && bodyAllowed(status) {
+		header.Set("Content-Length", strconv.FormatInt(w.written, 10))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
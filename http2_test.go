@@ -0,0 +1,198 @@
+package httpserver
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const (
+	frameData     = 0x0
+	frameHeaders  = 0x1
+	frameReset    = 0x3
+	frameSettings = 0x4
+	framePing     = 0x6
+	frameGoAway   = 0x7
+
+	flagEndStream  = 0x1
+	flagAck        = 0x1
+	flagEndHeaders = 0x4
+
+	settingMaxConcurrentStreams = 0x3
+)
+
+func writeFrame(t *testing.T, w io.Writer, frameType, flags byte, stream uint32, payload []byte) {
+	header := make([]byte, 9, 9+len(payload))
+	header[0], header[1], header[2] = byte(len(payload)>>16), byte(len(payload)>>8), byte(len(payload))
+	header[3], header[4] = frameType, flags
+	binary.BigEndian.PutUint32(header[5:], stream)
+	if _, err := w.Write(append(header, payload...)); err != nil {
+		t.Fatal("Failed to write frame:", err)
+	}
+}
+
+func readFrame(t *testing.T, r io.Reader) (frameType, flags byte, stream uint32, payload []byte) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatal("Failed to read frame:", err)
+	}
+	payload = make([]byte, int(header[0])<<16|int(header[1])<<8|int(header[2]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal("Failed to read frame:", err)
+	}
+	return header[3], header[4], binary.BigEndian.Uint32(header[5:]) & 0x7fffffff, payload
+}
+
+// literalHeaders encodes headers with HPACK literals that are never indexed,
+// which avoids needing an encoder for a single request.
+func literalHeaders(fields ...string) []byte {
+	var block []byte
+	for i := 0; i < len(fields); i += 2 {
+		block = append(block, 0x10, byte(len(fields[i])))
+		block = append(block, fields[i]...)
+		block = append(block, byte(len(fields[i+1])))
+		block = append(block, fields[i+1]...)
+	}
+	return block
+}
+
+func TestHTTP2GoAwayOnShutdown(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		close(entered)
+		<-release
+		writer.Write([]byte("done"))
+	})
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")}}
+	server.SetCloseIdleOnShutdown(true)
+	server.SetStartupHandler(nil)
+	address := startServer(t, server)[len("http://"):]
+	server.SetReady(true)
+	conn, err := tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer conn.Close()
+	if protocol := conn.ConnectionState().NegotiatedProtocol; protocol != "h2" {
+		t.Fatalf("Expected h2, negotiated %q", protocol)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	io.WriteString(conn, "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+	writeFrame(t, conn, frameSettings, 0, 0, nil)
+	writeFrame(t, conn, frameHeaders, flagEndStream|flagEndHeaders, 1,
+		literalHeaders(":method", "GET", ":scheme", "https", ":path", "/slow", ":authority", address))
+	<-entered
+
+	wait := server.Stop()
+	var goAway, responded bool
+	var body []byte
+	for !responded {
+		frameType, flags, stream, payload := readFrame(t, reader)
+		switch frameType {
+		case frameSettings:
+			if flags&flagAck == 0 {
+				writeFrame(t, conn, frameSettings, flagAck, 0, nil)
+			}
+		case framePing:
+			if flags&flagAck == 0 {
+				writeFrame(t, conn, framePing, flagAck, 0, payload)
+			}
+		case frameGoAway:
+			goAway = true
+			if last := binary.BigEndian.Uint32(payload) & 0x7fffffff; last < 1 {
+				t.Fatal("GOAWAY did not include the in-flight stream, last stream", last)
+			}
+			if code := binary.BigEndian.Uint32(payload[4:]); code != 0 {
+				t.Fatal("Expected NO_ERROR, received error code", code)
+			}
+			close(release)
+		case frameData:
+			if stream == 1 {
+				body = append(body, payload...)
+				responded = flags&flagEndStream != 0
+			}
+		case frameHeaders:
+			if stream == 1 && flags&flagEndStream != 0 {
+				responded = true
+			}
+		}
+	}
+	if !goAway {
+		t.Fatal("Expected GOAWAY before the in-flight stream completed")
+	}
+	if string(body) != "done" {
+		t.Fatalf("Expected the in-flight stream to complete, received %q", body)
+	}
+	conn.Close()
+	select {
+	case <-wait:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not finish shutting down")
+	}
+}
+
+func TestHTTP2Config(t *testing.T) {
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+	defer close(release)
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")}}
+	server.SetHTTP2Config(&http.HTTP2Config{MaxConcurrentStreams: 1})
+	address := startServer(t, server)[len("http://"):]
+	conn, err := tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	io.WriteString(conn, "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+	writeFrame(t, conn, frameSettings, 0, 0, nil)
+	for {
+		frameType, flags, _, payload := readFrame(t, reader)
+		if frameType != frameSettings || flags&flagAck != 0 {
+			continue
+		}
+		advertised := false
+		for i := 0; i+6 <= len(payload); i += 6 {
+			if binary.BigEndian.Uint16(payload[i:]) == settingMaxConcurrentStreams {
+				advertised = true
+				if limit := binary.BigEndian.Uint32(payload[i+2:]); limit != 1 {
+					t.Fatal("Expected a stream limit of 1, advertised", limit)
+				}
+			}
+		}
+		if !advertised {
+			t.Fatal("Expected the stream limit to be advertised")
+		}
+		writeFrame(t, conn, frameSettings, flagAck, 0, nil)
+		break
+	}
+	headers := literalHeaders(":method", "GET", ":scheme", "https", ":path", "/", ":authority", address)
+	writeFrame(t, conn, frameHeaders, flagEndStream|flagEndHeaders, 1, headers)
+	<-entered
+	writeFrame(t, conn, frameHeaders, flagEndStream|flagEndHeaders, 3, headers)
+	for {
+		frameType, _, stream, _ := readFrame(t, reader)
+		if frameType == frameGoAway {
+			t.Fatal("Expected the excess stream to be reset, not the connection")
+		}
+		if frameType == frameReset && stream == 3 {
+			break
+		}
+	}
+	select {
+	case <-entered:
+		t.Fatal("Expected the excess stream not to be served")
+	default:
+	}
+}
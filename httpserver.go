@@ -3,11 +3,27 @@ package httpserver
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// ErrNotRunning is returned by operations that require a running Server.
+var ErrNotRunning = errors.New("httpserver: server is not running")
+
+// ErrAlreadyStarted is returned when starting a Server that is already
+// starting, running or shutting down.
+var ErrAlreadyStarted = errors.New("httpserver: server already started")
+
 // Server helps reduce boilerplate when writing tools that center around
 // an http.Server instance.
 //
@@ -48,22 +64,160 @@ import (
 //			flag.Parse()
 //			sigChan := make(chan os.Signal)
 //			signal.Notify(sigChan, syscall.SIGINT, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGQUIT)
-//			s := httpserver.New(http.NewServeMux().ServeHTTP)
+//			s := httpserver.NewMux()
 //			go monitorSignal(s, sigChan)
 //			s.Start(serverConfig.Address)
 //			<-s.Wait()
 //		}
+//
+// Run implements the same pattern, handling signals with the escalation set
+// by SetSignalEscalation.
 type Server struct {
 	TLSConfig       *tls.Config
 	quit            chan struct{}
 	wait            chan struct{}
 	started         chan struct{}
+	failed          chan struct{}
+	serveFailed     func()
 	handlerFunc     http.HandlerFunc
-	address         net.Addr
-	server          *http.Server
-	DisableHTTP2    bool
-	listening       bool
-	shutdownHandler func()
+	mux             *http.ServeMux
+	fileServer      bool
+	notFoundHandler http.Handler
+
+	replacedHandler atomic.Pointer[http.HandlerFunc]
+	reloader        func() error
+	reloadMutex     sync.Mutex
+	reloadChanges   atomic.Pointer[reloadChanges]
+	certificate     atomic.Pointer[tls.Certificate]
+
+	address           atomic.Pointer[net.Addr]
+	network           string
+	useTLS            bool
+	listener          net.Listener
+	listenerFile      *os.File
+	server            *http.Server
+	DisableHTTP2      bool
+	listening         bool
+	shutdownHandler   func()
+	shutdownWebhook   *shutdownWebhook
+	shutdownBarrier   func(context.Context) error
+	mutex             sync.Mutex
+	startMutex        sync.Mutex
+	lastError         error
+	stopContext       context.Context
+	stopReason        ShutdownReason
+	afterInFlight     bool
+	preShutdownDelay  time.Duration
+	preShutdown       atomic.Bool
+	preShutdownTimer  *time.Timer
+	stopGeneration    uint64
+	inFlight          atomic.Int64
+	startTime         time.Time
+	stopTime          time.Time
+	totalRequests     atomic.Int64
+	lastActivity      atomic.Int64
+	idleWindow        time.Duration
+	idleShutdown      time.Duration
+	statusCounts      [maxStatusCode + 1]atomic.Int64
+	activeConns       atomic.Int64
+	acceptedConns     atomic.Int64
+	connsMutex        sync.Mutex
+	nextConnID        atomic.Uint64
+	conns             map[net.Conn]*trackedConn
+	connsByID         map[uint64]*trackedConn
+	connOrigins       map[net.Conn]*addedListener
+	added             []*addedListener
+	connectionHandler func(ConnInfo)
+	bytesIn           atomic.Int64
+	bytesOut          atomic.Int64
+	readiness         atomic.Int32
+	startupHandler    http.Handler
+	notReadyResponse  *notReadyResponse
+	readinessProbe    *readinessProbe
+	trustedProxies    []netip.Prefix
+	accessLog         *accessLog
+	companions        []*companion
+	protocols         *http.Protocols
+	http2Config       *http.HTTP2Config
+	listenerFactory   func(address string) (net.Listener, error)
+	errorResponder    ErrorResponder
+	listenBacklog     int
+	responseBuffer    int
+	deadlineHeader    string
+	pidFile           string
+	observers         []func(RequestInfo)
+	latencyShedder    *latencyShedder
+	keepAliveConfig   *net.KeepAliveConfig
+	maintenance       atomic.Pointer[http.Handler]
+	maintenanceExempt map[string]bool
+	favicon           *favicon
+	name              string
+	autoHead          bool
+	intercepts        []intercept
+	logger            *log.Logger
+	quiet             bool
+
+	decompressRequests   bool
+	maxDecompressedBytes int64
+
+	acceptErrorHandler func(error) bool
+	tlsErrorHandler    func(error)
+
+	suppressHandshakeErrors bool
+	tlsConfigSelector       func(*tls.ClientHelloInfo) (*tls.Config, error)
+	tlsConfigFunc           func() (*tls.Config, error)
+
+	sessionTicketRotation time.Duration
+	background            sync.WaitGroup
+
+	baseContextParent context.Context
+	baseContext       context.Context
+	cancelBaseContext context.CancelFunc
+
+	shutdownCtx           context.Context
+	cancelShutdownContext context.CancelFunc
+	closeCtx              context.Context
+	cancelClose           context.CancelFunc
+	signalEscalation      []SignalAction
+	exit                  func(code int)
+	tasks                 sync.WaitGroup
+
+	drainProgressHandler  func(inFlight int)
+	drainProgressInterval time.Duration
+	drainLogInterval      time.Duration
+
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+
+	shutdownTimeout     time.Duration
+	connDrainDeadline   time.Duration
+	streamDrainDeadline time.Duration
+	closeIdleOnShutdown bool
+	streamsMutex        sync.Mutex
+	streams             map[uint64]func(context.Context)
+	nextStream          uint64
+
+	pathNormalization  *PathNormOptions
+	maxURLLength       int
+	requestIDHeader    string
+	instanceID         string
+	allowedMethods     []string
+	passOptions        bool
+	disableKeepAlives  bool
+	closePaths         map[string]bool
+	http10Policy       HTTP10Policy
+	connMaxLifetime    time.Duration
+	maxRequestDuration time.Duration
+	routeTimeouts      []routeTimeout
+	maxRequestsPerConn int
+	defaultHeaders     http.Header
+	hsts               string
+	noSniff            bool
+	defaultContentType string
+	maxBodyBytes       int64
+	disallowTrailers   bool
 }
 
 // New returns a server with the specified handler.
@@ -73,6 +227,30 @@ func New(handlerFunc http.HandlerFunc) *Server {
 	}
 }
 
+// NewMux returns a server whose handler is a new http.ServeMux. Register
+// routes on it with Handle and HandleFunc.
+func NewMux() *Server {
+	mux := http.NewServeMux()
+	s := New(mux.ServeHTTP)
+	s.mux = mux
+	return s
+}
+
+// Handle registers handler for pattern on the ServeMux of a Server created by
+// NewMux. See http.ServeMux for the pattern syntax.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	if s.mux == nil {
+		panic("httpserver: Handle called on a Server not created by NewMux")
+	}
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers handlerFunc for pattern on the ServeMux of a Server
+// created by NewMux.
+func (s *Server) HandleFunc(pattern string, handlerFunc http.HandlerFunc) {
+	s.Handle(pattern, handlerFunc)
+}
+
 // SetShutdownHandler lets you add a function to the shutdown pipeline. It
 // will be called after http.Server.Shutdown and will block Stop and Wait until
 // it returns.
@@ -80,67 +258,447 @@ func (s *Server) SetShutdownHandler(shutdownHandler func()) {
 	s.shutdownHandler = shutdownHandler
 }
 
+// SetBaseContext sets the parent of the context that every request context is
+// derived from. The Server wraps it in a context that it cancels once
+// in-flight requests have drained during shutdown, so work rooted in
+// BaseContext unwinds along with the Server.
+func (s *Server) SetBaseContext(ctx context.Context) {
+	s.baseContextParent = ctx
+}
+
+// BaseContext returns the context that request contexts are derived from while
+// the Server is running. Work that should outlive an individual request but not
+// the Server, such as goroutines started by a handler, can be rooted in it; it
+// is cancelled after in-flight requests have drained during shutdown.
+func (s *Server) BaseContext() context.Context {
+	if s.baseContext == nil {
+		return context.Background()
+	}
+	return s.baseContext
+}
+
+// SetLogger sets the logger used for the Server's lifecycle messages. The
+// standard logger is used by default.
+func (s *Server) SetLogger(logger *log.Logger) {
+	s.logger = logger
+}
+
+// SetQuiet suppresses the Server's lifecycle logging when quiet is true.
+func (s *Server) SetQuiet(quiet bool) {
+	s.quiet = quiet
+}
+
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.quiet {
+		return
+	}
+	s.print(fmt.Sprintf(format, v...))
+}
+
+// print writes a line to the Server's logger, labelled with the name set by
+// SetName.
+func (s *Server) print(line string) {
+	if s.name != "" {
+		line = s.name + ": " + line
+	}
+	if s.logger != nil {
+		s.logger.Print(line)
+		return
+	}
+	log.Print(line)
+}
+
+// SetName labels the Server, to tell apart several Servers in one process,
+// such as an admin and a public Server. The name prefixes the Server's log
+// lines, including net/http's error log, and is reported by Name and Stats.
+func (s *Server) SetName(name string) {
+	s.name = name
+}
+
+// Name returns the name set by SetName or, if none was set, the Server's
+// address once it has started.
+func (s *Server) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+	if address := s.Address(); address != nil {
+		return address.String()
+	}
+	return ""
+}
+
+// Uptime returns how long the Server has been listening. It is zero before
+// Start, and stops advancing once the Server begins shutting down.
+func (s *Server) Uptime() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case s.startTime.IsZero():
+		return 0
+	case s.listening:
+		return time.Since(s.startTime)
+	}
+	return s.stopTime.Sub(s.startTime)
+}
+
+// InFlight returns the number of requests currently being handled.
+func (s *Server) InFlight() int {
+	return int(s.inFlight.Load())
+}
+
+// HTTP2Enabled reports whether the Server is configured to negotiate HTTP/2.
+// Unless SetProtocols enables unencrypted HTTP/2, HTTP/2 is only offered over
+// TLS, where net/http advertises "h2" via ALPN unless DisableHTTP2 is set or
+// SetProtocols excludes it. The result reflects the configured intent rather
+// than the protocol any particular client negotiates. It is valid after Start.
+func (s *Server) HTTP2Enabled() bool {
+	if s.protocols != nil {
+		if s.TLSConfig != nil {
+			return s.protocols.HTTP2()
+		}
+		return s.protocols.UnencryptedHTTP2()
+	}
+	return s.TLSConfig != nil && !s.DisableHTTP2
+}
+
+// SetProtocols sets the protocols the Server accepts, using the
+// http.Server.Protocols field added in Go 1.24. For example, enabling
+// UnencryptedHTTP2 serves HTTP/2 with prior knowledge over plain TCP without
+// an h2c wrapper. When protocols is set DisableHTTP2 is ignored.
+func (s *Server) SetProtocols(protocols *http.Protocols) {
+	s.protocols = protocols
+}
+
+// SetHTTP2Config sets the limits used for HTTP/2 connections, such as
+// MaxConcurrentStreams, MaxReadFrameSize and the ping and idle timeouts,
+// through the http.Server.HTTP2 field added in Go 1.24. Tight stream limits
+// help protect against abuse such as rapid-reset floods. Whether HTTP/2 is
+// served at all is still decided by DisableHTTP2 and SetProtocols; the config
+// is unused when HTTP2Enabled is false. Zero fields keep net/http's defaults.
+func (s *Server) SetHTTP2Config(config *http.HTTP2Config) {
+	s.http2Config = config
+}
+
+// IsTLS reports whether the Server is serving over TLS. It is valid after
+// Start.
+func (s *Server) IsTLS() bool {
+	return s.useTLS
+}
+
 // Address returns the server's current address.
 func (s *Server) Address() net.Addr {
-	return s.address
+	if address := s.address.Load(); address != nil {
+		return *address
+	}
+	return nil
 }
 
-func (s *Server) run(listener net.Listener) {
-	defer close(s.wait)
-	defer func() {
-		if s.shutdownHandler != nil {
-			s.shutdownHandler()
+// BaseURL returns the URL clients can use to reach the Server, such as
+// "https://example:8443", for logging and service registration. The scheme
+// follows IsTLS. When the Server is bound to an unspecified address such as
+// 0.0.0.0 or [::], the machine's host name is used in its place, or
+// "localhost" if the host name is unavailable. A Server on a Unix socket
+// returns an http+unix URL with the socket path escaped as its host. It is
+// empty before Start.
+func (s *Server) BaseURL() string {
+	address := s.Address()
+	if address == nil {
+		return ""
+	}
+	scheme := "http"
+	if s.useTLS {
+		scheme = "https"
+	}
+	if s.network == "unix" {
+		return scheme + "+unix://" + url.PathEscape(address.String())
+	}
+	host, port, err := net.SplitHostPort(address.String())
+	if err != nil {
+		return scheme + "://" + address.String()
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && ip.IsUnspecified() {
+		if host, err = os.Hostname(); err != nil || host == "" {
+			host = "localhost"
 		}
-	}()
-	s.server = &http.Server{Handler: http.HandlerFunc(s.handlerFunc)}
-	if s.DisableHTTP2 {
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+func (s *Server) serve(listener net.Listener) {
+	serveFailed := s.serveFailed
+	listener = s.wrapListener(listener)
+	if s.useTLS {
+		listener = tls.NewListener(listener, s.server.TLSConfig)
+	}
+	err := s.server.Serve(listener)
+	if !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+		s.setError(err)
+		serveFailed()
+	}
+}
+
+// LastError returns the most recent error encountered while serving or
+// shutting down, or nil if there has been none since the Server was last
+// started.
+func (s *Server) LastError() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastError
+}
+
+func (s *Server) setError(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastError = err
+}
+
+func (s *Server) run(listener net.Listener) {
+	s.server = &http.Server{
+		Handler:     s.handler(),
+		ErrorLog:    s.errorLog(),
+		ConnContext: s.connContext,
+		ConnState:   s.connState,
+		BaseContext: func(listener net.Listener) context.Context {
+			ctx := context.WithValue(s.baseContext, serverAddrKey, listener.Addr())
+			ctx = context.WithValue(ctx, startTimeKey, s.startTime)
+			return context.WithValue(ctx, serverKey, s)
+		},
+		ReadTimeout:       s.readTimeout,
+		ReadHeaderTimeout: s.readHeaderTimeout,
+		WriteTimeout:      s.writeTimeout,
+		IdleTimeout:       s.idleTimeout,
+	}
+	s.server.SetKeepAlivesEnabled(!s.disableKeepAlives)
+	s.server.HTTP2 = s.http2Config
+	if s.protocols != nil {
+		s.server.Protocols = s.protocols
+	} else if s.DisableHTTP2 {
 		s.server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
 	}
-	defer s.server.Shutdown(context.Background())
-	if s.TLSConfig != nil {
-		s.server.TLSConfig = s.TLSConfig
-		go s.server.ServeTLS(listener, "", "")
-	} else {
-		go s.server.Serve(listener)
+	if s.useTLS {
+		s.server.TLSConfig = s.effectiveTLSConfig()
+		if s.sessionTicketRotation > 0 {
+			s.goBackground(func(done <-chan struct{}) {
+				rotateSessionTicketKeys(s.server.TLSConfig, s.sessionTicketRotation, done)
+			})
+		}
+	}
+	if s.readinessProbe != nil {
+		s.goBackground(func(done <-chan struct{}) {
+			s.runReadinessProbe(*s.readinessProbe, done)
+		})
+	}
+	if s.idleShutdown > 0 {
+		s.goBackground(func(done <-chan struct{}) {
+			s.stopWhenIdle(s.idleShutdown, done)
+		})
+	}
+	// Wait for Serve to begin accepting so that WaitForStart means the
+	// Server is serving, not merely bound.
+	accepting := make(chan struct{})
+	go s.serve(&acceptNotifyListener{Listener: listener, accepting: sync.OnceFunc(func() { close(accepting) })})
+	select {
+	case <-accepting:
+	case <-s.failed:
+	}
+	scheme := "HTTP"
+	if s.useTLS {
+		scheme = "HTTPS"
 	}
-	log.Println("Listening for requests on", s.Address())
+	s.logf("Listening for %s requests on %s", scheme, s.Address())
+	if s.idleTimeout == 0 && s.readTimeout > 0 {
+		s.logf("Idle timeout not set, using read timeout of %s", s.readTimeout)
+	}
+	s.serveCompanions()
 	close(s.started)
 	<-s.quit
+	// Wait must not be released until every stage of shutdown has finished.
+	s.shutdown()
+	if s.shutdownWebhook != nil {
+		s.callShutdownWebhook(s.shutdownWebhook)
+	}
+	if s.shutdownHandler != nil {
+		s.shutdownHandler()
+	}
+	close(s.wait)
 }
 
 // Start starts the Server listening on the specified tcp address. If no port is
 // specified, the Server will pick one. Use Address() after start to see which
-// port was selected.
+// port was selected. A Server may be started again once Wait is released;
+// until then Start returns ErrAlreadyStarted.
 func (s *Server) Start(address string) (err error) {
 	return s.start("tcp", address)
 }
 
+// StartPreferred is like Start, but if the requested port is already in use
+// the Server falls back to a port picked by the system on the same host rather
+// than failing. It is intended for development tools; use Start where a busy
+// port should be fatal. The address that was bound is logged and returned.
+func (s *Server) StartPreferred(address string) (net.Addr, error) {
+	err := s.start("tcp", address)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		host, _, splitErr := net.SplitHostPort(address)
+		if splitErr != nil {
+			return nil, err
+		}
+		if err = s.start("tcp", net.JoinHostPort(host, "0")); err == nil {
+			s.logf("Address %s in use, falling back to %s", address, s.Address())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Address(), nil
+}
+
 // StartSocket starts the Server listening on the specified socket.
 func (s *Server) StartSocket(address string) (err error) {
 	return s.start("unix", address)
 }
 
 func (s *Server) start(network, address string) (err error) {
+	if err := s.lockStart(); err != nil {
+		return err
+	}
+	defer s.startMutex.Unlock()
+	listener, err := s.listen(network, address)
+	if err != nil {
+		return err
+	}
+	if err = s.startListener(network, listener); err != nil {
+		listener.Close()
+		return err
+	}
+	return nil
+}
+
+func (s *Server) startListener(network string, listener net.Listener) error {
+	if s.tlsConfigFunc != nil {
+		config, err := s.tlsConfigFunc()
+		if err == nil && config == nil {
+			err = errors.New("no config returned")
+		}
+		if err != nil {
+			return fmt.Errorf("httpserver: building TLS config: %w", err)
+		}
+		s.TLSConfig = config
+	}
+	if err := s.listenCompanions(); err != nil {
+		return err
+	}
+	if err := s.writePidFile(); err != nil {
+		for _, c := range s.companions {
+			c.listener.Close()
+		}
+		return err
+	}
+	s.setError(nil)
+	s.resetStatusCounts()
+	s.readiness.Store(int32(ReadinessStarting))
 	s.quit = make(chan struct{})
 	s.wait = make(chan struct{})
 	s.started = make(chan struct{})
-	listener, err := net.Listen(network, address)
-	if err != nil {
-		return err
+	failed := make(chan struct{})
+	s.failed = failed
+	s.serveFailed = sync.OnceFunc(func() { close(failed) })
+	parent := s.baseContextParent
+	if parent == nil {
+		parent = context.Background()
 	}
-	s.address = listener.Addr()
+	s.baseContext, s.cancelBaseContext = context.WithCancel(parent)
+	s.shutdownCtx, s.cancelShutdownContext = context.WithCancel(context.Background())
+	s.closeCtx, s.cancelClose = context.WithCancel(context.Background())
+	s.useTLS = s.TLSConfig != nil
+	s.network = network
+	s.mutex.Lock()
+	s.setListener(listener)
+	s.added = nil
 	s.listening = true
+	s.stopReason = ShutdownNone
+	s.preShutdown.Store(false)
+	s.startTime = time.Now()
+	s.lastActivity.Store(s.startTime.UnixNano())
+	s.mutex.Unlock()
 	go s.run(listener)
 	return nil
 }
 
+// lockStart acquires the lock held while the Server is being started, or
+// returns ErrAlreadyStarted if the Server has not finished a previous run.
+func (s *Server) lockStart() error {
+	s.startMutex.Lock()
+	s.mutex.Lock()
+	wait := s.wait
+	s.mutex.Unlock()
+	if wait != nil {
+		select {
+		case <-wait:
+		default:
+			s.startMutex.Unlock()
+			return ErrAlreadyStarted
+		}
+	}
+	return nil
+}
+
+// Restart moves a running Server to a new address on the same network without
+// interrupting service. The new address is bound before the current listener
+// is closed, so if binding fails the Server keeps serving on its current
+// address and the error is returned. Connections already accepted on the old
+// address are served until they complete. Restart is safe to call alongside
+// Stop and other calls to Restart, which are applied one at a time.
+func (s *Server) Restart(address string) error {
+	s.startMutex.Lock()
+	defer s.startMutex.Unlock()
+	if !s.IsListening() {
+		return ErrNotRunning
+	}
+	listener, err := s.listen(s.network, address)
+	if err != nil {
+		return err
+	}
+	<-s.started
+	s.mutex.Lock()
+	if !s.listening {
+		s.mutex.Unlock()
+		listener.Close()
+		return ErrNotRunning
+	}
+	previous := s.listener
+	s.closeListenerFile()
+	s.setListener(listener)
+	// Shutdown waits for background work, so a listener swapped in while
+	// it begins is closed before Wait is released.
+	s.background.Add(1)
+	s.mutex.Unlock()
+	go func() {
+		defer s.background.Done()
+		s.serve(listener)
+	}()
+	previous.Close()
+	return nil
+}
+
+// setListener records the listener the Server accepts connections on. It is
+// called with the mutex held.
+func (s *Server) setListener(listener net.Listener) {
+	address := listener.Addr()
+	s.listener = listener
+	s.address.Store(&address)
+}
+
 // IsListening returns true if the server is running
 func (s *Server) IsListening() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	return s.listening
 }
 
 // WaitForStart returns a channel that is closed when the Server has finished
-// starting and is listening for connections on Address().
+// starting and is accepting connections on Address(), so a client may connect
+// as soon as it is closed. It is also closed if the Server fails to begin
+// serving, in which case LastError reports why.
 func (s *Server) WaitForStart() <-chan struct{} {
 	return s.started
 }
@@ -150,10 +708,135 @@ func (s *Server) Wait() <-chan struct{} {
 	return s.wait
 }
 
+// Close shuts the Server down immediately, closing its listener and every
+// connection without waiting for requests in flight, streams or tasks started
+// with Go. It may be called while a graceful Stop is draining to abandon the
+// drain. It returns the channel from Wait.
+func (s *Server) Close() <-chan struct{} {
+	return s.close(ShutdownClose)
+}
+
+func (s *Server) close(reason ShutdownReason) <-chan struct{} {
+	s.mutex.Lock()
+	started, cancelClose := s.started, s.cancelClose
+	s.mutex.Unlock()
+	if started == nil {
+		return s.stop(context.Background(), reason)
+	}
+	cancelClose()
+	wait := s.stop(s.closeCtx, reason)
+	<-started
+	s.server.Close()
+	return wait
+}
+
 // Stop gracefully shuts down the Server and returns the channel from Wait.
 // Note that it has the same limitations as http.Server.Shutdown.
+//
+// Stop does not block, so it may be called from a handler, such as an admin
+// shutdown endpoint: the handler's request is drained like any other, and its
+// response is delivered once it returns. The handler must not wait on the
+// returned channel, since the drain waits for the handler.
 func (s *Server) Stop() <-chan struct{} {
+	return s.StopContext(context.Background())
+}
+
+// StopOn gracefully shuts down the Server when ch receives a value or is
+// closed, so that an external event source can trigger shutdown. It returns
+// ErrNotRunning unless the Server is running; the goroutine it starts exits
+// when the Server stops for any reason. Each call registers an additional
+// trigger.
+func (s *Server) StopOn(ch <-chan struct{}) error {
+	s.startMutex.Lock()
+	defer s.startMutex.Unlock()
+	if !s.IsListening() {
+		return ErrNotRunning
+	}
+	wait := s.wait
+	go func() {
+		select {
+		case <-ch:
+			s.stop(context.Background(), ShutdownTrigger)
+		case <-wait:
+		}
+	}()
+	return nil
+}
+
+// StopContext is like Stop, but the drain is abandoned when ctx is done,
+// letting the caller choose the shutdown deadline for this call. It is
+// combined with the timeout set by SetShutdownTimeout, if any. Only the first
+// call to Stop or StopContext initiates shutdown; later calls return the same
+// channel and their contexts are ignored.
+func (s *Server) StopContext(ctx context.Context) <-chan struct{} {
+	return s.stop(ctx, ShutdownStop)
+}
+
+// StopAfterInFlight shuts the Server down once the requests already in flight
+// have finished, for when traffic has been moved away upstream. The Server
+// stops accepting connections at once, skipping any pre-shutdown delay, and
+// serves no further requests on open connections. There is no deadline: the
+// shutdown timeout, drain deadlines and stream closers are not applied, so
+// long requests must be bounded by request-level timeouts. Close still ends
+// the drain.
+func (s *Server) StopAfterInFlight() <-chan struct{} {
+	return s.stopDrain(context.Background(), ShutdownStop, true)
+}
+
+func (s *Server) stop(ctx context.Context, reason ShutdownReason) <-chan struct{} {
+	return s.stopDrain(ctx, reason, false)
+}
+
+// stopDrain initiates shutdown. If afterInFlight is set, the shutdown waits
+// for in-flight requests without a deadline, as for StopAfterInFlight.
+func (s *Server) stopDrain(ctx context.Context, reason ShutdownReason, afterInFlight bool) <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.wait == nil {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	if !s.listening {
+		return s.wait
+	}
+	closing := s.closeCtx.Err() != nil
+	if s.preShutdownTimer != nil {
+		// A stop is already waiting out the pre-shutdown delay, which Close
+		// cuts short.
+		if closing {
+			s.beginShutdown()
+		}
+		return s.wait
+	}
+	s.stopContext = ctx
+	s.stopReason = reason
+	s.afterInFlight = afterInFlight
+	if s.preShutdownDelay > 0 && !closing && !afterInFlight {
+		s.preShutdown.Store(true)
+		s.stopGeneration++
+		generation := s.stopGeneration
+		s.preShutdownTimer = time.AfterFunc(s.preShutdownDelay, func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if s.stopGeneration == generation && s.preShutdownTimer != nil {
+				s.beginShutdown()
+			}
+		})
+		return s.wait
+	}
+	s.beginShutdown()
+	return s.wait
+}
+
+// beginShutdown ends any pre-shutdown delay and releases run to shut the
+// Server down. It is called with the mutex held.
+func (s *Server) beginShutdown() {
+	if s.preShutdownTimer != nil {
+		s.preShutdownTimer.Stop()
+		s.preShutdownTimer = nil
+	}
 	s.listening = false
+	s.stopTime = time.Now()
 	close(s.quit)
-	return s.Wait()
 }
@@ -1,9 +1,17 @@
 package httpserver
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"sync"
 	"testing"
 	"time"
 )
@@ -47,12 +55,12 @@ func TestServeStop(t *testing.T) {
 	select {
 	case <-shutdownChannel:
 		t.Fatal("Shutdown channel closed prematurely")
-	case <-time.After(time.Microsecond):
+	default:
 	}
 	<-server.Stop()
 	select {
 	case <-shutdownChannel:
-	case <-time.After(time.Microsecond):
+	default:
 		t.Fatal("Shutdown not closed after shutdown")
 	}
 	if server.IsListening() {
@@ -66,3 +74,470 @@ func TestServeStop(t *testing.T) {
 		t.Fatal("Request received after shutdown")
 	}
 }
+
+func TestHandlerContextCancelledOnDisconnect(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		close(started)
+		select {
+		case <-request.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	})
+	// Each of these wraps the writer or the request context, so a wrapper
+	// that hid the disconnect would fail the test.
+	server.EnableResponseBuffering(4096)
+	server.SetMaxRequestDuration(time.Minute)
+	server.SetDefaultContentType("text/plain")
+	server.EnableAutoHead()
+	server.EnableRequestID("")
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer server.Stop()
+	<-server.WaitForStart()
+	conn, err := net.Dial("tcp", server.Address().String())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err := conn.Write([]byte("GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	<-started
+	conn.Close()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Handler context not cancelled after client disconnect")
+	}
+}
+
+func TestDrainProgress(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		close(started)
+		<-release
+		writer.Write([]byte("OK"))
+	})
+	progress := make(chan int, 100)
+	server.SetDrainProgressHandler(func(inFlight int) {
+		progress <- inFlight
+	})
+	server.SetDrainProgressInterval(10 * time.Millisecond)
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	<-server.WaitForStart()
+	go http.Get(fmt.Sprintf("http://%s/slow", server.Address()))
+	<-started
+	if server.InFlight() != 1 {
+		t.Fatalf("Expected 1 request in flight, found %d", server.InFlight())
+	}
+	wait := server.Stop()
+	select {
+	case inFlight := <-progress:
+		if inFlight != 1 {
+			t.Fatalf("Expected progress to report 1 request in flight, found %d", inFlight)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Drain progress not reported")
+	}
+	close(release)
+	<-wait
+	for len(progress) > 0 {
+		<-progress
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(progress) != 0 {
+		t.Fatal("Drain progress reported after shutdown completed")
+	}
+}
+
+func TestRestart(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("OK"))
+	})
+	if err := server.Restart("127.0.0.1:"); err != ErrNotRunning {
+		t.Fatal("Expected ErrNotRunning, received", err)
+	}
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer server.Stop()
+	<-server.WaitForStart()
+	oldAddr := server.Address()
+	if err := server.Restart("---"); err == nil {
+		t.Fatal("Expected failure on bad address")
+	}
+	if server.Address() != oldAddr {
+		t.Fatal("Address changed after failed restart")
+	}
+	if _, err := http.Get(fmt.Sprintf("http://%s/", oldAddr)); err != nil {
+		t.Fatal("Unexpected error after failed restart:", err)
+	}
+	if err := server.Restart("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	newAddr := server.Address()
+	if newAddr.String() == oldAddr.String() {
+		t.Fatal("Expected a new address after restart")
+	}
+	response, err := http.Get(fmt.Sprintf("http://%s/", newAddr))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	if string(body) != "OK" {
+		t.Fatalf("Expected \"OK\" received \"%s\"", string(body))
+	}
+	if _, err := net.Dial("tcp", oldAddr.String()); err == nil {
+		t.Fatal("Expected old address to be closed")
+	}
+}
+
+func TestRestartConcurrently(t *testing.T) {
+	server := New(writeString("OK"))
+	startServer(t, server)
+	done := make(chan struct{})
+	probed := make(chan struct{})
+	go func() {
+		defer close(probed)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			server.Address()
+			server.Addresses()
+			server.BaseURL()
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Restart("127.0.0.1:"); err != nil && err != ErrNotRunning {
+				t.Error("Unexpected error:", err)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-server.Stop()
+	}()
+	wg.Wait()
+	close(done)
+	<-probed
+	if server.IsListening() {
+		t.Fatal("Expected the Server to have stopped")
+	}
+	if _, err := net.Dial("tcp", server.Address().String()); err == nil {
+		t.Fatal("Expected the final address to be closed")
+	}
+}
+
+func TestHTTP2Enabled(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {})
+	if server.HTTP2Enabled() {
+		t.Fatal("HTTP/2 should not be enabled without TLS")
+	}
+	server.TLSConfig = &tls.Config{}
+	if !server.HTTP2Enabled() {
+		t.Fatal("HTTP/2 should be enabled with TLS")
+	}
+	server.DisableHTTP2 = true
+	if server.HTTP2Enabled() {
+		t.Fatal("HTTP/2 should not be enabled when disabled")
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	for _, quiet := range []bool{false, true} {
+		var buffer bytes.Buffer
+		server := New(func(writer http.ResponseWriter, request *http.Request) {})
+		server.SetLogger(log.New(&buffer, "", 0))
+		server.SetQuiet(quiet)
+		if err := server.Start("127.0.0.1:"); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		<-server.WaitForStart()
+		<-server.Stop()
+		if logged := buffer.Len() > 0; logged == quiet {
+			t.Fatalf("Expected logging to be %v when quiet is %v, logged %q", !quiet, quiet, buffer.String())
+		}
+	}
+}
+
+type testContextKey struct{}
+
+func TestBaseContextCancelledOnShutdown(t *testing.T) {
+	done := make(chan struct{})
+	var server *Server
+	server = New(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Context().Value(testContextKey{}) != "value" {
+			t.Error("Request context not derived from the base context")
+		}
+		go func() {
+			<-server.BaseContext().Done()
+			close(done)
+		}()
+		writer.Write([]byte("OK"))
+	})
+	server.SetBaseContext(context.WithValue(context.Background(), testContextKey{}, "value"))
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	<-server.WaitForStart()
+	if _, err := http.Get(fmt.Sprintf("http://%s/", server.Address())); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	select {
+	case <-done:
+		t.Fatal("Base context cancelled before shutdown")
+	default:
+	}
+	<-server.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Base context not cancelled after shutdown")
+	}
+}
+
+func TestWaitBlocksOnShutdownHandler(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	finished := false
+	server := New(func(writer http.ResponseWriter, request *http.Request) {})
+	server.SetShutdownHandler(func() {
+		close(entered)
+		<-release
+		finished = true
+	})
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	<-server.WaitForStart()
+	wait := server.Stop()
+	<-entered
+	select {
+	case <-wait:
+		t.Fatal("Wait returned before the shutdown handler finished")
+	default:
+	}
+	close(release)
+	<-wait
+	if !finished {
+		t.Fatal("Wait returned before the shutdown handler finished")
+	}
+}
+
+func TestStartPreferred(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer taken.Close()
+	server := New(func(writer http.ResponseWriter, request *http.Request) {})
+	if err := server.Start(taken.Addr().String()); err == nil {
+		t.Fatal("Expected failure on a port in use")
+	}
+	addr, err := server.StartPreferred(taken.Addr().String())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer server.Stop()
+	if addr.String() == taken.Addr().String() || addr.String() != server.Address().String() {
+		t.Fatal("Unexpected fallback address:", addr)
+	}
+	if host, _, _ := net.SplitHostPort(addr.String()); host != "127.0.0.1" {
+		t.Fatal("Fallback address changed host:", addr)
+	}
+}
+
+func TestSetProtocols(t *testing.T) {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(request.Proto))
+	})
+	server.DisableHTTP2 = true
+	server.SetProtocols(&protocols)
+	if !server.HTTP2Enabled() {
+		t.Fatal("Unencrypted HTTP/2 should be enabled")
+	}
+	base := startServer(t, server)
+	var clientProtocols http.Protocols
+	clientProtocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &clientProtocols}}
+	response, err := client.Get(base + "/")
+	if err != nil {
+		t.Fatal("Request failed:", err)
+	}
+	defer response.Body.Close()
+	if body, _ := ioutil.ReadAll(response.Body); string(body) != "HTTP/2.0" {
+		t.Fatalf("Expected HTTP/2.0, received %q", body)
+	}
+	if _, body := get(t, base+"/"); body != "HTTP/1.1" {
+		t.Fatalf("Expected HTTP/1.1, received %q", body)
+	}
+}
+
+func TestConcurrentStart(t *testing.T) {
+	server := New(writeString("OK"))
+	server.SetQuiet(true)
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { results <- server.Start("127.0.0.1:") }()
+	}
+	first, second := <-results, <-results
+	if (first == nil) == (second == nil) {
+		t.Fatal("Expected exactly one Start to succeed:", first, second)
+	}
+	if first != nil && first != ErrAlreadyStarted || second != nil && second != ErrAlreadyStarted {
+		t.Fatal("Expected ErrAlreadyStarted:", first, second)
+	}
+	if _, body := get(t, "http://"+server.Address().String()+"/"); body != "OK" {
+		t.Fatalf("Unexpected body %q", body)
+	}
+	<-server.Stop()
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Expected restart after Stop to succeed:", err)
+	}
+	<-server.Stop()
+}
+
+func TestWaitForStartAccepting(t *testing.T) {
+	server := New(writeString("OK"))
+	server.SetQuiet(true)
+	for i := 0; i < 50; i++ {
+		if err := server.Start("127.0.0.1:"); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		<-server.WaitForStart()
+		conn, err := net.DialTimeout("tcp", server.Address().String(), time.Second)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		conn.SetDeadline(time.Now().Add(time.Second))
+		fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+		response, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil || !bytes.HasSuffix(response, []byte("\r\n\r\nOK")) {
+			t.Fatalf("Request %d after WaitForStart failed with %q: %v", i, response, err)
+		}
+		<-server.Stop()
+	}
+}
+
+// TestStartUnderConnectionFlood dials the Server's address in a tight loop
+// from before it binds until after it stops, and checks that every connection
+// that is accepted is either served or closed, never left hanging.
+func TestStartUnderConnectionFlood(t *testing.T) {
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	address := reserved.Addr().String()
+	reserved.Close()
+
+	server := New(writeString("OK"))
+	server.SetQuiet(true)
+	stop := make(chan struct{})
+	hung := make(chan error, 1)
+	served := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				conn, err := net.DialTimeout("tcp", address, time.Second)
+				if err != nil {
+					continue
+				}
+				conn.SetDeadline(time.Now().Add(2 * time.Second))
+				fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+				response, err := ioutil.ReadAll(conn)
+				conn.Close()
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					select {
+					case hung <- err:
+					default:
+					}
+				} else if bytes.HasSuffix(response, []byte("\r\n\r\nOK")) {
+					select {
+					case served <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := server.Start(address); err != nil {
+		close(stop)
+		wg.Wait()
+		t.Fatal("Unexpected error:", err)
+	}
+	<-server.WaitForStart()
+	time.Sleep(100 * time.Millisecond)
+	<-server.Stop()
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	select {
+	case err := <-hung:
+		t.Fatal("Connection accepted but never served:", err)
+	default:
+	}
+	select {
+	case <-served:
+	default:
+		t.Fatal("No requests were served")
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	server := New(writeString("OK"))
+	server.SetQuiet(true)
+	if url := server.BaseURL(); url != "" {
+		t.Fatal("Expected no base URL before Start, found", url)
+	}
+	base := startServer(t, server)
+	if url := server.BaseURL(); url != base {
+		t.Fatalf("Expected %q, found %q", base, url)
+	}
+	<-server.Stop()
+
+	if err := server.Start(":0"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	_, port, _ := net.SplitHostPort(server.Address().String())
+	if url := server.BaseURL(); url != "http://"+net.JoinHostPort(host, port) {
+		t.Fatalf("Expected the host name in place of the unspecified address, found %q", url)
+	}
+	<-server.Stop()
+
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")}}
+	startServer(t, server)
+	if url := server.BaseURL(); url != "https://"+server.Address().String() {
+		t.Fatal("Unexpected TLS base URL", url)
+	}
+}
@@ -0,0 +1,37 @@
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTCPKeepAliveConfig(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		conn, ok := connFromContext(request.Context()).Conn.(*net.TCPConn)
+		if !ok {
+			t.Error("Expected a TCP connection")
+			return
+		}
+		raw, err := conn.SyscallConn()
+		if err != nil {
+			t.Error("Unexpected error:", err)
+			return
+		}
+		var idle, interval, count int
+		raw.Control(func(fd uintptr) {
+			idle, _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE)
+			interval, _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL)
+			count, _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT)
+		})
+		fmt.Fprint(writer, idle, interval, count)
+	})
+	server.SetTCPKeepAliveConfig(net.KeepAliveConfig{Enable: true, Idle: 42 * time.Second, Interval: 7 * time.Second, Count: 3})
+	base := startServer(t, server)
+	if _, body := get(t, base+"/"); body != "42 7 3" {
+		t.Fatalf("Expected keep-alive idle, interval and count of 42 7 3, found %q", body)
+	}
+}
@@ -0,0 +1,212 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ListenerFD returns the file descriptor of the Server's listening socket, for
+// use with tools that correlate or tune sockets out-of-band. The descriptor is
+// a duplicate owned by the Server: closing it does not affect the listener,
+// and it remains valid only until the Server shuts down or restarts, at which
+// point it is closed. An error is returned if the listener cannot provide a
+// file, such as when it is neither a TCP nor a Unix socket.
+func (s *Server) ListenerFD() (uintptr, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.listening {
+		return 0, ErrNotRunning
+	}
+	if s.listenerFile == nil {
+		filer, ok := s.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return 0, fmt.Errorf("httpserver: listener %T does not provide a file descriptor", s.listener)
+		}
+		file, err := filer.File()
+		if err != nil {
+			return 0, err
+		}
+		s.listenerFile = file
+	}
+	// Fd would switch the shared socket to blocking mode, so read the
+	// descriptor through SyscallConn instead.
+	raw, err := s.listenerFile.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var fd uintptr
+	if err := raw.Control(func(f uintptr) { fd = f }); err != nil {
+		return 0, err
+	}
+	return fd, nil
+}
+
+// closeListenerFile closes the descriptor returned by ListenerFD, if any. It
+// is called with the mutex held.
+func (s *Server) closeListenerFile() {
+	if s.listenerFile != nil {
+		s.listenerFile.Close()
+		s.listenerFile = nil
+	}
+}
+
+// SetAcceptErrorHandler sets a function that is called with each error
+// returned when accepting a connection. If it returns true the Server retries
+// after a short backoff, otherwise it stops accepting connections on that
+// listener. By default temporary errors are retried and all others stop the
+// listener, as with http.Server. The handler is not called for errors caused
+// by the listener being closed during shutdown.
+func (s *Server) SetAcceptErrorHandler(handler func(err error) (retry bool)) {
+	s.acceptErrorHandler = handler
+}
+
+// acceptError marks an error as permanent so that http.Server does not retry
+// it regardless of whether the underlying error is temporary.
+type acceptError struct {
+	error
+}
+
+func (e acceptError) Unwrap() error {
+	return e.error
+}
+
+// countingListener counts the connections accepted from its listener.
+type countingListener struct {
+	net.Listener
+	accepted *atomic.Int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return conn, err
+}
+
+// AcceptedConnections returns the number of connections the Server has
+// accepted since it was created, counted at the socket before any TLS
+// handshake or request. Compared with TotalRequests in Stats, it shows
+// connections that are opened but never send a request, such as those from
+// port scanners or broken clients.
+func (s *Server) AcceptedConnections() int64 {
+	return s.acceptedConns.Load()
+}
+
+type acceptListener struct {
+	net.Listener
+	handler func(error) bool
+}
+
+func (l *acceptListener) Accept() (net.Conn, error) {
+	var delay time.Duration
+	for {
+		conn, err := l.Listener.Accept()
+		if err == nil {
+			return conn, nil
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return nil, err
+		}
+		if !l.handler(err) {
+			return nil, acceptError{err}
+		}
+		if delay == 0 {
+			delay = 5 * time.Millisecond
+		} else if delay *= 2; delay > time.Second {
+			delay = time.Second
+		}
+		time.Sleep(delay)
+	}
+}
+
+// acceptNotifyListener calls accepting when the first Accept call begins.
+type acceptNotifyListener struct {
+	net.Listener
+	accepting func()
+}
+
+func (l *acceptNotifyListener) Accept() (net.Conn, error) {
+	l.accepting()
+	return l.Listener.Accept()
+}
+
+// SetTCPKeepAliveConfig sets the TCP keep-alive probing applied to every
+// accepted TCP connection, for control over the idle time, interval and count
+// of probes on connections that cross flaky networks, in place of the 15
+// second period net/http uses by default. It uses net.KeepAliveConfig, added
+// in Go 1.23. Options the platform does not support are left at the system
+// defaults; see net.TCPConn.SetKeepAliveConfig. Connections that are not TCP,
+// such as those on Unix sockets, are unaffected.
+func (s *Server) SetTCPKeepAliveConfig(config net.KeepAliveConfig) {
+	s.keepAliveConfig = &config
+}
+
+type keepAliveListener struct {
+	net.Listener
+	config net.KeepAliveConfig
+}
+
+func (l *keepAliveListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		// Errors only mean some options are unsupported here, which is
+		// documented as leaving them at their defaults.
+		tcpConn.SetKeepAliveConfig(l.config)
+	}
+	return conn, err
+}
+
+func (s *Server) wrapListener(listener net.Listener) net.Listener {
+	listener = &countingListener{Listener: listener, accepted: &s.acceptedConns}
+	if s.keepAliveConfig != nil {
+		listener = &keepAliveListener{Listener: listener, config: *s.keepAliveConfig}
+	}
+	if s.acceptErrorHandler != nil {
+		listener = &acceptListener{Listener: listener, handler: s.acceptErrorHandler}
+	}
+	return listener
+}
+
+// SetListenerFactory sets the function used to create TCP listeners in place
+// of net.Listen, such as an in-memory listener for tests that exercise the
+// full request and shutdown path without using the network, or a listener for
+// another transport. It is used by Start, StartPreferred, Restart, Validate
+// and the challenge and admin listeners; StartSocket and StartUnix always use
+// Unix sockets.
+func (s *Server) SetListenerFactory(factory func(address string) (net.Listener, error)) {
+	s.listenerFactory = factory
+}
+
+func (s *Server) listen(network, address string) (net.Listener, error) {
+	if network == "tcp" && s.listenerFactory != nil {
+		return s.listenerFactory(address)
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil && network == "unix" {
+		return nil, socketPathError(address, err)
+	}
+	if err == nil && s.listenBacklog > 0 {
+		if err := setListenBacklog(listener, s.listenBacklog); err != nil {
+			s.logf("Failed to set listen backlog to %d: %v", s.listenBacklog, err)
+		}
+	}
+	return listener, err
+}
+
+var errNoBacklog = errors.New("httpserver: listen backlog is not supported on this platform")
+
+// SetListenBacklog asks the operating system to queue up to n connections
+// that have not yet been accepted, to absorb bursts of new connections. Go
+// does not expose the backlog, so on Unix systems the Server calls listen(2)
+// again after binding. It is best-effort: the kernel may cap n (on Linux at
+// net.core.somaxconn), it is unsupported on other platforms and for listeners
+// from SetListenerFactory, and failures are logged rather than returned. Zero
+// keeps the backlog chosen by net.Listen.
+func (s *Server) SetListenBacklog(n int) {
+	s.listenBacklog = n
+}
@@ -0,0 +1,250 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListenerFD(t *testing.T) {
+	server := New(writeString("OK"))
+	if _, err := server.ListenerFD(); err != ErrNotRunning {
+		t.Fatal("Expected ErrNotRunning, received", err)
+	}
+	base := startServer(t, server)
+	fd, err := server.ListenerFD()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if fd <= 2 {
+		t.Fatal("Unexpected file descriptor:", fd)
+	}
+	if again, _ := server.ListenerFD(); again != fd {
+		t.Fatalf("Expected the same descriptor, received %d and %d", fd, again)
+	}
+	if _, body := get(t, base+"/"); body != "OK" {
+		t.Fatalf("Expected \"OK\" received \"%s\"", body)
+	}
+}
+
+func TestListenerFDDuringRestart(t *testing.T) {
+	server := New(writeString("OK"))
+	startServer(t, server)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			if err := server.Restart("127.0.0.1:"); err != nil {
+				t.Error("Unexpected error:", err)
+			}
+		}
+		<-server.Stop()
+	}()
+	for {
+		select {
+		case <-done:
+			if _, err := server.ListenerFD(); err != ErrNotRunning {
+				t.Fatal("Expected ErrNotRunning after Stop, received", err)
+			}
+			return
+		default:
+		}
+		if _, err := server.ListenerFD(); err != nil && err != ErrNotRunning {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+}
+
+type flakyListener struct {
+	net.Listener
+	errs []error
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if len(l.errs) > 0 {
+		err := l.errs[0]
+		l.errs = l.errs[1:]
+		return nil, err
+	}
+	return l.Listener.Accept()
+}
+
+func TestAcceptErrorHandler(t *testing.T) {
+	transient := errors.New("transient")
+	fatal := errors.New("fatal")
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer listener.Close()
+	var handled []error
+	server := New(writeString("OK"))
+	server.SetAcceptErrorHandler(func(err error) bool {
+		handled = append(handled, err)
+		return err == transient
+	})
+	wrapped := server.wrapListener(&flakyListener{Listener: listener, errs: []error{transient, fatal}})
+	if _, err := wrapped.Accept(); !errors.Is(err, fatal) {
+		t.Fatal("Expected fatal error, received", err)
+	}
+	if len(handled) != 2 || handled[0] != transient || handled[1] != fatal {
+		t.Fatal("Unexpected handled errors:", handled)
+	}
+	listener.Close()
+	if _, err := wrapped.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatal("Expected closed error, received", err)
+	}
+	if len(handled) != 2 {
+		t.Fatal("Handler called for closed listener:", handled)
+	}
+}
+
+func TestLastError(t *testing.T) {
+	fatal := errors.New("fatal")
+	server := New(writeString("OK"))
+	server.SetAcceptErrorHandler(func(err error) bool { return false })
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	<-server.WaitForStart()
+	if server.LastError() != nil {
+		t.Fatal("Unexpected error:", server.LastError())
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	go server.serve(&flakyListener{Listener: listener, errs: []error{fatal}})
+	deadline := time.Now().Add(time.Second)
+	for !errors.Is(server.LastError(), fatal) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected fatal error, received", server.LastError())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-server.Stop()
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer server.Stop()
+	if server.LastError() != nil {
+		t.Fatal("Last error not reset on Start:", server.LastError())
+	}
+}
+
+func TestStopWithWrappedListener(t *testing.T) {
+	var buffer bytes.Buffer
+	var handled []error
+	server := New(writeString("OK"))
+	server.SetLogger(log.New(&buffer, "", 0))
+	server.SetAcceptErrorHandler(func(err error) bool {
+		handled = append(handled, err)
+		return false
+	})
+	base := startServer(t, server)
+	get(t, base+"/")
+	// Restart closes the first listener while the Server keeps running.
+	if err := server.Restart("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	get(t, "http://"+server.Address().String()+"/")
+	<-server.Stop()
+	if len(handled) != 0 {
+		t.Fatal("Handler called for a closed listener:", handled)
+	}
+	if server.LastError() != nil {
+		t.Fatal("Unexpected error:", server.LastError())
+	}
+	if strings.Contains(buffer.String(), "closed") {
+		t.Fatalf("Unexpected log output: %q", buffer.String())
+	}
+}
+
+// pipeListener is an in-memory listener whose connections are created by
+// Dial with net.Pipe.
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+func (l *pipeListener) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+func TestListenerFactory(t *testing.T) {
+	listener := newPipeListener()
+	server := New(writeString("in memory"))
+	server.SetQuiet(true)
+	var requested string
+	server.SetListenerFactory(func(address string) (net.Listener, error) {
+		requested = address
+		return listener, nil
+	})
+	if err := server.Start("example:80"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if requested != "example:80" || server.Address().String() != "pipe" {
+		t.Fatalf("Unexpected address %q, %v", requested, server.Address())
+	}
+	client := &http.Client{Transport: &http.Transport{DialContext: listener.Dial}}
+	response, err := client.Get("http://example/")
+	if err != nil {
+		t.Fatal("Request failed:", err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "in memory" {
+		t.Fatalf("Unexpected body %q", body)
+	}
+	<-server.Stop()
+	if server.LastError() != nil {
+		t.Fatal("Unexpected error:", server.LastError())
+	}
+	if _, err := listener.Dial(context.Background(), "", ""); !errors.Is(err, net.ErrClosed) {
+		t.Fatal("Expected the listener to be closed, received", err)
+	}
+}
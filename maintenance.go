@@ -0,0 +1,54 @@
+package httpserver
+
+import (
+	"net/http"
+)
+
+// maintenanceRetryAfter is the Retry-After sent with the default maintenance
+// response, in seconds.
+const maintenanceRetryAfter = "300"
+
+// SetMaintenanceMode turns maintenance mode on or off. While it is on, every
+// request is served by handler in place of the Server's handler, except for
+// intercepts, such as health checks, and the paths set with
+// SetMaintenanceExemptPaths. If handler is nil, requests receive 503 Service
+// Unavailable with a Retry-After of five minutes. It may be called at any
+// time, and takes effect immediately on a running Server.
+func (s *Server) SetMaintenanceMode(on bool, handler http.Handler) {
+	if !on {
+		s.maintenance.Store(nil)
+		return
+	}
+	if handler == nil {
+		handler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Retry-After", maintenanceRetryAfter)
+			s.serviceUnavailable(writer, request)
+		})
+	}
+	s.maintenance.Store(&handler)
+}
+
+// InMaintenanceMode reports whether maintenance mode is on.
+func (s *Server) InMaintenanceMode() bool {
+	return s.maintenance.Load() != nil
+}
+
+// SetMaintenanceExemptPaths sets paths that are served by the Server's
+// handler as usual while maintenance mode is on. It must be called before
+// Start.
+func (s *Server) SetMaintenanceExemptPaths(paths ...string) {
+	s.maintenanceExempt = make(map[string]bool, len(paths))
+	for _, path := range paths {
+		s.maintenanceExempt[path] = true
+	}
+}
+
+// maintenanceHandler returns the handler to serve request with if maintenance
+// mode applies to it.
+func (s *Server) maintenanceHandler(request *http.Request) (http.Handler, bool) {
+	handler := s.maintenance.Load()
+	if handler == nil || s.maintenanceExempt[request.URL.Path] {
+		return nil, false
+	}
+	return *handler, true
+}
@@ -0,0 +1,40 @@
+package httpserver
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	server := New(writeString("main"))
+	server.Intercept("/healthz", writeString("healthy"))
+	server.SetMaintenanceExemptPaths("/status")
+	base := startServer(t, server)
+	if _, body := get(t, base+"/"); body != "main" {
+		t.Fatal("Unexpected body:", body)
+	}
+
+	server.SetMaintenanceMode(true, nil)
+	if !server.InMaintenanceMode() {
+		t.Fatal("Expected maintenance mode to be on")
+	}
+	response, _ := get(t, base+"/")
+	if response.StatusCode != http.StatusServiceUnavailable || response.Header.Get("Retry-After") != "300" {
+		t.Fatalf("Expected 503 with Retry-After, received %s %v", response.Status, response.Header)
+	}
+	for path, expected := range map[string]string{"/healthz": "healthy", "/status": "main"} {
+		if _, body := get(t, base+path); body != expected {
+			t.Errorf("Expected %q for exempt %s, received %q", expected, path, body)
+		}
+	}
+
+	server.SetMaintenanceMode(true, writeString("back soon"))
+	if _, body := get(t, base+"/"); body != "back soon" {
+		t.Fatal("Unexpected body:", body)
+	}
+
+	server.SetMaintenanceMode(false, nil)
+	if _, body := get(t, base+"/"); body != "main" || server.InMaintenanceMode() {
+		t.Fatal("Maintenance mode not turned off:", body)
+	}
+}
@@ -0,0 +1,414 @@
+package httpserver
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrailingSlash selects the canonical trailing slash form enforced by path
+// normalization.
+type TrailingSlash int
+
+const (
+	// TrailingSlashPreserve leaves trailing slashes as they were sent.
+	TrailingSlashPreserve TrailingSlash = iota
+	// TrailingSlashAdd makes every path end with a slash.
+	TrailingSlashAdd
+	// TrailingSlashRemove strips the trailing slash from every path but "/".
+	TrailingSlashRemove
+)
+
+// PathNormOptions configures EnablePathNormalization.
+type PathNormOptions struct {
+	// TrailingSlash is the canonical trailing slash form.
+	TrailingSlash TrailingSlash
+	// Redirect responds to non-canonical paths with a 308 Permanent Redirect
+	// to the canonical path instead of rewriting the request in place.
+	Redirect bool
+}
+
+// EnablePathNormalization collapses repeated slashes in request paths and
+// applies the configured trailing slash form before requests reach the
+// Server's handler. The query string is left intact.
+func (s *Server) EnablePathNormalization(options PathNormOptions) {
+	s.pathNormalization = &options
+}
+
+func normalizePath(p string, trailingSlash TrailingSlash) string {
+	var builder strings.Builder
+	builder.Grow(len(p) + 1)
+	if !strings.HasPrefix(p, "/") {
+		builder.WriteByte('/')
+	}
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && i > 0 && p[i-1] == '/' {
+			continue
+		}
+		builder.WriteByte(p[i])
+	}
+	normalized := builder.String()
+	switch trailingSlash {
+	case TrailingSlashAdd:
+		if !strings.HasSuffix(normalized, "/") {
+			normalized += "/"
+		}
+	case TrailingSlashRemove:
+		if len(normalized) > 1 {
+			normalized = strings.TrimSuffix(normalized, "/")
+		}
+	}
+	return normalized
+}
+
+func normalizePaths(options PathNormOptions, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		normalized := normalizePath(request.URL.Path, options.TrailingSlash)
+		if normalized == request.URL.Path {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		if options.Redirect {
+			target := url.URL{Path: normalized, RawQuery: request.URL.RawQuery}
+			writer.Header().Set("Location", target.RequestURI())
+			writer.WriteHeader(http.StatusPermanentRedirect)
+			return
+		}
+		rewritten := new(http.Request)
+		*rewritten = *request
+		rewritten.URL = new(url.URL)
+		*rewritten.URL = *request.URL
+		rewritten.URL.Path = normalized
+		rewritten.URL.RawPath = ""
+		handler.ServeHTTP(writer, rewritten)
+	})
+}
+
+// SetMaxURLLength rejects requests whose request URI is longer than n bytes
+// with 414 Request-URI Too Long before they reach the Server's handler. Zero
+// means no limit.
+func (s *Server) SetMaxURLLength(n int) {
+	s.maxURLLength = n
+}
+
+func limitURLLength(n int, respond ErrorResponder, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if len(request.RequestURI) > n {
+			respond(writer, http.StatusRequestURITooLong, http.StatusText(http.StatusRequestURITooLong))
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// SetInstanceID adds an X-Served-By header carrying id to every response, to
+// identify which instance served a request behind a load balancer. If id is
+// empty the host name is used.
+func (s *Server) SetInstanceID(id string) {
+	if id == "" {
+		id, _ = os.Hostname()
+	}
+	s.instanceID = id
+}
+
+func setHeader(key, value string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set(key, value)
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// SetAllowedMethods rejects requests using any other method with 405 Method
+// Not Allowed and an Allow header listing the permitted methods. OPTIONS
+// requests are answered automatically with the same Allow header unless
+// SetOptionsPassthrough is enabled. With no methods, the default, every method
+// is allowed.
+func (s *Server) SetAllowedMethods(methods ...string) {
+	s.allowedMethods = methods
+}
+
+// SetOptionsPassthrough passes OPTIONS requests through to the Server's
+// handler instead of answering them automatically when allowed methods are
+// configured.
+func (s *Server) SetOptionsPassthrough(passthrough bool) {
+	s.passOptions = passthrough
+}
+
+func allowMethods(methods []string, passOptions bool, respond ErrorResponder, handler http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(methods)+1)
+	for _, method := range methods {
+		allowed[method] = true
+	}
+	allow := methods
+	if !allowed[http.MethodOptions] {
+		allow = append(append([]string{}, methods...), http.MethodOptions)
+	}
+	allowHeader := strings.Join(allow, ", ")
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodOptions {
+			if passOptions {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			writer.Header().Set("Allow", allowHeader)
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !allowed[request.Method] {
+			writer.Header().Set("Allow", allowHeader)
+			respond(writer, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// SetKeepAlivesEnabled controls whether HTTP keep-alives are enabled, so that
+// when disabled every connection serves a single request. Keep-alives are
+// enabled by default.
+func (s *Server) SetKeepAlivesEnabled(enabled bool) {
+	s.disableKeepAlives = !enabled
+}
+
+// SetConnectionClosePaths closes the connection after serving a request for
+// any of paths, by responding with Connection: close, while leaving keep-alives
+// enabled for every other path. This can isolate an endpoint used by clients
+// that misbehave on persistent or pipelined connections.
+func (s *Server) SetConnectionClosePaths(paths ...string) {
+	s.closePaths = make(map[string]bool, len(paths))
+	for _, path := range paths {
+		s.closePaths[path] = true
+	}
+}
+
+func closeConnections(paths map[string]bool, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if paths[request.URL.Path] {
+			writer.Header().Set("Connection", "close")
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// HTTP10Policy selects how the Server treats HTTP/1.0 requests.
+type HTTP10Policy int
+
+const (
+	// HTTP10Allow serves HTTP/1.0 requests like any other, honouring a
+	// client's Connection: keep-alive.
+	HTTP10Allow HTTP10Policy = iota
+	// HTTP10ForceClose serves HTTP/1.0 requests but closes the connection
+	// after each response, even if the client asked to keep it alive.
+	HTTP10ForceClose
+	// HTTP10Reject answers HTTP/1.0 requests with 426 Upgrade Required.
+	HTTP10Reject
+)
+
+// SetHTTP10Policy sets how the Server treats requests from legacy HTTP/1.0
+// clients, whose keep-alive handling some proxies get wrong. The default is
+// HTTP10Allow.
+func (s *Server) SetHTTP10Policy(policy HTTP10Policy) {
+	s.http10Policy = policy
+}
+
+func applyHTTP10Policy(policy HTTP10Policy, respond ErrorResponder, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.ProtoMajor != 1 || request.ProtoMinor != 0 {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		writer.Header().Set("Connection", "close")
+		if policy == HTTP10Reject {
+			writer.Header().Set("Upgrade", "HTTP/1.1")
+			respond(writer, http.StatusUpgradeRequired, http.StatusText(http.StatusUpgradeRequired))
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// SetDefaultHeaders sets headers that are added to every response before the
+// Server's handler runs, replacing any set previously. Handlers can override
+// or remove them.
+func (s *Server) SetDefaultHeaders(headers http.Header) {
+	s.defaultHeaders = headers.Clone()
+}
+
+// AddDefaultHeader adds a header to the set added to every response.
+func (s *Server) AddDefaultHeader(key, value string) {
+	if s.defaultHeaders == nil {
+		s.defaultHeaders = make(http.Header)
+	}
+	s.defaultHeaders.Add(key, value)
+}
+
+// EnableHSTS adds a Strict-Transport-Security header with the given max age
+// to every response served over TLS. It is never sent over plaintext
+// connections, where browsers ignore it.
+func (s *Server) EnableHSTS(maxAge time.Duration, includeSubdomains, preload bool) {
+	s.hsts = "max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+	if includeSubdomains {
+		s.hsts += "; includeSubDomains"
+	}
+	if preload {
+		s.hsts += "; preload"
+	}
+}
+
+// DisableContentSniffing adds X-Content-Type-Options: nosniff to every
+// response, alongside the default headers, so that browsers honour the
+// declared Content-Type instead of guessing one, which guards against MIME
+// confusion attacks. Pair it with SetDefaultContentType so that responses
+// without a Content-Type are not sniffed by net/http either.
+func (s *Server) DisableContentSniffing() {
+	s.noSniff = true
+}
+
+// SetDefaultContentType sets the Content-Type of responses whose handler does
+// not set one, in place of the type net/http would detect from the first bytes
+// of the body. Handlers that delete the header, by setting it to nil, still
+// send no Content-Type. An empty contentType, the default, leaves detection
+// in place.
+func (s *Server) SetDefaultContentType(contentType string) {
+	s.defaultContentType = contentType
+}
+
+func setDefaultContentType(contentType string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		handler.ServeHTTP(&contentTypeWriter{ResponseWriter: writer, contentType: contentType}, request)
+	})
+}
+
+// contentTypeWriter sets a Content-Type on responses that lack one when their
+// header is sent.
+type contentTypeWriter struct {
+	http.ResponseWriter
+	contentType string
+	wrote       bool
+}
+
+func (w *contentTypeWriter) WriteHeader(status int) {
+	if !w.wrote && status >= 200 {
+		w.wrote = true
+		header := w.Header()
+		if _, ok := header["Content-Type"]; !ok && bodyAllowed(status) {
+			header.Set("Content-Type", w.contentType)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *contentTypeWriter) Write(p []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *contentTypeWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+func (w *contentTypeWriter) Flush() {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *contentTypeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *contentTypeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func addDefaultHeaders(headers http.Header, hsts string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		header := writer.Header()
+		for key, values := range headers {
+			header[key] = append(header[key], values...)
+		}
+		if hsts != "" && request.TLS != nil {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// SetMaxBodyBytes limits request bodies to n bytes, whether their size is
+// declared with Content-Length or they are sent with chunked encoding.
+// Requests declaring a larger Content-Length are rejected with 413 Request
+// Entity Too Large before the Server's handler runs. Otherwise reads past the
+// limit fail with an *http.MaxBytesError, and if the handler returns without
+// writing a response a 413 is sent for it. A 413 response closes the
+// connection. Zero means no limit.
+func (s *Server) SetMaxBodyBytes(n int64) {
+	s.maxBodyBytes = n
+}
+
+// limitedBody records whether a body read failed because it exceeded the
+// limit of the http.MaxBytesReader it wraps.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+func limitBody(n int64, respond ErrorResponder, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.ContentLength > n {
+			writer.Header().Set("Connection", "close")
+			respond(writer, http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+			return
+		}
+		body := &limitedBody{ReadCloser: http.MaxBytesReader(writer, request.Body, n)}
+		request.Body = body
+		recorder := &responseWriter{ResponseWriter: writer}
+		handler.ServeHTTP(recorder, request)
+		if body.exceeded && !recorder.wroteHeader() {
+			writer.Header().Set("Connection", "close")
+			respond(writer, http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge))
+		}
+	})
+}
+
+// SetAllowRequestTrailers controls whether trailers sent after a chunked
+// request body are made available to handlers in Request.Trailer. When
+// disallowed they are read and discarded. Trailers are allowed by default.
+func (s *Server) SetAllowRequestTrailers(allow bool) {
+	s.disallowTrailers = !allow
+}
+
+func dropTrailers(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Trailer != nil {
+			// net/http fills in the original request's Trailer map as the
+			// body is read, so the handler's copy never sees the values.
+			stripped := new(http.Request)
+			*stripped = *request
+			stripped.Trailer = nil
+			request = stripped
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
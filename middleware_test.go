@@ -0,0 +1,433 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func echoURL(writer http.ResponseWriter, request *http.Request) {
+	writer.Write([]byte(request.URL.RequestURI()))
+}
+
+func TestPathNormalizationRewrite(t *testing.T) {
+	server := New(echoURL)
+	server.EnablePathNormalization(PathNormOptions{TrailingSlash: TrailingSlashRemove})
+	base := startServer(t, server)
+	for path, expected := range map[string]string{
+		"/":               "/",
+		"/a//b/?x=1&y=2":  "/a/b?x=1&y=2",
+		"//a///b":         "/a/b",
+		"/already/normal": "/already/normal",
+	} {
+		if _, body := get(t, base+path); body != expected {
+			t.Fatalf("Expected %q for %s, received %q", expected, path, body)
+		}
+	}
+}
+
+func TestPathNormalizationRedirect(t *testing.T) {
+	server := New(echoURL)
+	server.EnablePathNormalization(PathNormOptions{TrailingSlash: TrailingSlashAdd, Redirect: true})
+	base := startServer(t, server)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(base + "/a//b?x=1")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusPermanentRedirect {
+		t.Fatal("Expected a permanent redirect, received", response.Status)
+	}
+	if location := response.Header.Get("Location"); location != "/a/b/?x=1" {
+		t.Fatal("Unexpected redirect location:", location)
+	}
+	if _, body := get(t, base+"/a//b?x=1"); body != "/a/b/?x=1" {
+		t.Fatal("Unexpected body after redirect:", body)
+	}
+}
+
+func TestMaxURLLength(t *testing.T) {
+	server := New(echoURL)
+	server.SetMaxURLLength(32)
+	base := startServer(t, server)
+	if response, body := get(t, base+"/short?q=1"); response.StatusCode != http.StatusOK || body != "/short?q=1" {
+		t.Fatal("Unexpected response:", response.Status, body)
+	}
+	if response, _ := get(t, base+"/"+strings.Repeat("a", 32)); response.StatusCode != http.StatusRequestURITooLong {
+		t.Fatal("Expected 414, received", response.Status)
+	}
+}
+
+func TestInstanceID(t *testing.T) {
+	server := New(writeString("OK"))
+	server.SetInstanceID("instance-1")
+	base := startServer(t, server)
+	if response, _ := get(t, base+"/"); response.Header.Get("X-Served-By") != "instance-1" {
+		t.Fatal("Unexpected X-Served-By:", response.Header.Get("X-Served-By"))
+	}
+	hostname, _ := os.Hostname()
+	server = New(writeString("OK"))
+	server.SetInstanceID("")
+	base = startServer(t, server)
+	if response, _ := get(t, base+"/"); response.Header.Get("X-Served-By") != hostname {
+		t.Fatal("Expected host name in X-Served-By, received", response.Header.Get("X-Served-By"))
+	}
+}
+
+func TestAllowedMethods(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(request.Method))
+	})
+	server.SetAllowedMethods(http.MethodGet, http.MethodHead)
+	base := startServer(t, server)
+	if response, body := get(t, base+"/"); response.StatusCode != http.StatusOK || body != "GET" {
+		t.Fatal("Unexpected response:", response.Status, body)
+	}
+	response, err := http.Post(base+"/", "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatal("Expected 405, received", response.Status)
+	}
+	if allow := response.Header.Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Fatal("Unexpected Allow header:", allow)
+	}
+	request, _ := http.NewRequest(http.MethodOptions, base+"/", nil)
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNoContent || response.Header.Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Fatal("Unexpected OPTIONS response:", response.Status, response.Header.Get("Allow"))
+	}
+}
+
+func TestAllowedMethodsOptionsPassthrough(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(request.Method))
+	})
+	server.SetAllowedMethods(http.MethodGet)
+	server.SetOptionsPassthrough(true)
+	base := startServer(t, server)
+	request, _ := http.NewRequest(http.MethodOptions, base+"/", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatal("Expected OPTIONS to reach the handler, received", response.Status)
+	}
+}
+
+func TestConnectionClosePaths(t *testing.T) {
+	server := New(writeString("OK"))
+	server.SetConnectionClosePaths("/legacy")
+	base := startServer(t, server)
+	if response, _ := get(t, base+"/legacy"); !response.Close {
+		t.Fatal("Expected Connection: close on /legacy")
+	}
+	if response, _ := get(t, base+"/modern"); response.Close {
+		t.Fatal("Unexpected Connection: close on /modern")
+	}
+}
+
+func TestKeepAlivesDisabled(t *testing.T) {
+	server := New(writeString("OK"))
+	server.SetKeepAlivesEnabled(false)
+	base := startServer(t, server)
+	if response, _ := get(t, base+"/"); !response.Close {
+		t.Fatal("Expected connection to close with keep-alives disabled")
+	}
+}
+
+func TestHTTP10Policy(t *testing.T) {
+	for policy, expected := range map[HTTP10Policy]struct {
+		status int
+		close  bool
+	}{
+		HTTP10Allow:      {http.StatusOK, false},
+		HTTP10ForceClose: {http.StatusOK, true},
+		HTTP10Reject:     {http.StatusUpgradeRequired, true},
+	} {
+		server := New(writeString("OK"))
+		server.SetHTTP10Policy(policy)
+		base := startServer(t, server)
+		conn, err := net.Dial("tcp", strings.TrimPrefix(base, "http://"))
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		fmt.Fprint(conn, "GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n")
+		response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != expected.status || response.Close != expected.close {
+			t.Errorf("Policy %d: expected %d with close %t, received %s with close %t", policy, expected.status, expected.close, response.Status, response.Close)
+		}
+		if policy == HTTP10Reject && response.Header.Get("Upgrade") != "HTTP/1.1" {
+			t.Error("Expected an Upgrade header, received", response.Header)
+		}
+	}
+	server := New(writeString("OK"))
+	server.SetHTTP10Policy(HTTP10Reject)
+	base := startServer(t, server)
+	if response, body := get(t, base+"/"); response.StatusCode != http.StatusOK || body != "OK" {
+		t.Fatalf("HTTP/1.1 request rejected: %s %q", response.Status, body)
+	}
+}
+
+func TestDefaultHeaders(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	})
+	server.SetDefaultHeaders(http.Header{"X-Content-Type-Options": {"nosniff"}, "X-Frame-Options": {"DENY"}})
+	server.AddDefaultHeader("Content-Security-Policy", "default-src 'self'")
+	server.EnableHSTS(365*24*time.Hour, true, false)
+	base := startServer(t, server)
+	response, _ := get(t, base+"/")
+	for key, expected := range map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"Content-Security-Policy":   "default-src 'self'",
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Strict-Transport-Security": "",
+	} {
+		if value := response.Header.Get(key); value != expected {
+			t.Fatalf("Expected %s to be %q, received %q", key, expected, value)
+		}
+	}
+}
+
+func TestDisableContentSniffing(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/json":
+			writer.Header().Set("Content-Type", "application/json")
+		case "/none":
+			writer.Header()["Content-Type"] = nil
+		case "/empty":
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writer.Write([]byte("<html><script>alert(1)</script></html>"))
+	})
+	server.AddDefaultHeader("X-Frame-Options", "DENY")
+	server.DisableContentSniffing()
+	server.SetDefaultContentType("application/octet-stream")
+	base := startServer(t, server)
+	for path, expected := range map[string]string{
+		"/":      "application/octet-stream",
+		"/json":  "application/json",
+		"/none":  "",
+		"/empty": "",
+	} {
+		response, _ := get(t, base+path)
+		if contentType := response.Header.Get("Content-Type"); contentType != expected {
+			t.Errorf("%s: expected Content-Type %q, received %q", path, expected, contentType)
+		}
+		if response.Header.Get("X-Content-Type-Options") != "nosniff" || response.Header.Get("X-Frame-Options") != "DENY" {
+			t.Errorf("%s: missing default headers: %v", path, response.Header)
+		}
+	}
+}
+
+func TestAutoHead(t *testing.T) {
+	body := strings.Repeat("x", 5000)
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("X-Kind", "get")
+		writer.Write([]byte(body))
+	})
+	server.EnableAutoHead()
+	base := startServer(t, server)
+	response, err := http.Head(base + "/")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.ContentLength != int64(len(body)) || response.Header.Get("X-Kind") != "get" {
+		t.Fatalf("Unexpected HEAD response %s with length %d and headers %v", response.Status, response.ContentLength, response.Header)
+	}
+	conn, err := net.Dial("tcp", strings.TrimPrefix(base, "http://"))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "HEAD / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	raw, _ := ioutil.ReadAll(conn)
+	if !strings.HasSuffix(string(raw), "\r\n\r\n") {
+		t.Fatalf("Expected no body after the HEAD headers, received %q", raw)
+	}
+	if _, got := get(t, base+"/"); got != body {
+		t.Fatal("GET body changed")
+	}
+}
+
+func TestRequestDecompression(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return
+		}
+		writer.Write(body)
+	})
+	server.EnableRequestDecompression(1000)
+	base := startServer(t, server)
+	compress := func(data string) *bytes.Buffer {
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		writer.Write([]byte(data))
+		writer.Close()
+		return &buffer
+	}
+	for _, test := range []struct {
+		encoding string
+		body     io.Reader
+		status   int
+		expected string
+	}{
+		{"gzip", compress("hello, world"), http.StatusOK, "hello, world"},
+		{"", strings.NewReader("plain"), http.StatusOK, "plain"},
+		{"gzip", compress(strings.Repeat("x", 2000)), http.StatusRequestEntityTooLarge, ""},
+		{"gzip", strings.NewReader("not gzip"), http.StatusBadRequest, ""},
+		{"br", strings.NewReader("brotli"), http.StatusUnsupportedMediaType, ""},
+	} {
+		request, _ := http.NewRequest("POST", base+"/", test.body)
+		if test.encoding != "" {
+			request.Header.Set("Content-Encoding", test.encoding)
+		}
+		response, body := post(t, request)
+		if response.StatusCode != test.status || test.status == http.StatusOK && body != test.expected {
+			t.Errorf("%s: expected %d %q, received %s %q", test.encoding, test.status, test.expected, response.Status, body)
+		}
+	}
+}
+
+// chunkedBody hides its length from http.Client so the request is sent with
+// chunked encoding.
+type chunkedBody struct {
+	io.Reader
+}
+
+func readBody(writer http.ResponseWriter, request *http.Request) {
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(writer, "%d %s", len(body), request.Trailer.Get("X-Checksum"))
+}
+
+func post(t *testing.T, request *http.Request) (*http.Response, string) {
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	return response, string(body)
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	server := New(readBody)
+	server.SetMaxBodyBytes(16)
+	base := startServer(t, server)
+	for _, test := range []struct {
+		body   io.Reader
+		status int
+	}{
+		{strings.NewReader("small"), http.StatusOK},
+		{strings.NewReader(strings.Repeat("a", 17)), http.StatusRequestEntityTooLarge},
+		{chunkedBody{strings.NewReader("small")}, http.StatusOK},
+		{chunkedBody{strings.NewReader(strings.Repeat("a", 1024))}, http.StatusRequestEntityTooLarge},
+	} {
+		request, _ := http.NewRequest("POST", base+"/", test.body)
+		response, body := post(t, request)
+		if response.StatusCode != test.status {
+			t.Fatalf("Expected %d, received %s: %s", test.status, response.Status, body)
+		}
+	}
+}
+
+func TestRequestTrailers(t *testing.T) {
+	for _, allow := range []bool{true, false} {
+		server := New(readBody)
+		server.SetAllowRequestTrailers(allow)
+		base := startServer(t, server)
+		request, _ := http.NewRequest("POST", base+"/", chunkedBody{strings.NewReader("data")})
+		request.Trailer = http.Header{"X-Checksum": {"abc"}}
+		_, body := post(t, request)
+		expected := "4 abc"
+		if !allow {
+			expected = "4 "
+		}
+		if body != expected {
+			t.Fatalf("Expected %q with trailers allowed %v, received %q", expected, allow, body)
+		}
+	}
+}
+
+func TestResponseBuffering(t *testing.T) {
+	// net/http sets Content-Length itself for unflushed responses of up to
+	// 2KB, so the responses here are larger than that.
+	medium := strings.Repeat("a", 3000)
+	handler := func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("X-Custom", "value")
+		writer.WriteHeader(http.StatusCreated)
+		switch request.URL.Path {
+		case "/medium":
+			writer.Write([]byte(medium))
+			writer.Write([]byte(medium))
+		case "/large":
+			writer.Write([]byte(medium))
+			writer.Write([]byte(strings.Repeat(medium, 3)))
+		case "/flushed":
+			writer.Write([]byte("partial"))
+			writer.(http.Flusher).Flush()
+		case "/twice":
+			writer.WriteHeader(http.StatusInternalServerError)
+			writer.Write([]byte("twice"))
+		}
+	}
+	unbuffered := startServer(t, New(handler))
+	if response, _ := get(t, unbuffered+"/medium"); response.ContentLength != -1 {
+		t.Fatal("Expected an unbuffered response to be chunked, Content-Length", response.ContentLength)
+	}
+	server := New(handler)
+	server.EnableResponseBuffering(8192)
+	base := startServer(t, server)
+	for _, test := range []struct {
+		path          string
+		contentLength int64
+		length        int
+	}{
+		{"/medium", 6000, 6000},
+		{"/large", -1, 12000},
+		{"/flushed", -1, 7},
+		{"/empty", 0, 0},
+		{"/twice", 5, 5},
+	} {
+		response, body := get(t, base+test.path)
+		if response.StatusCode != http.StatusCreated || response.Header.Get("X-Custom") != "value" {
+			t.Fatalf("%s: status and headers not passed through: %s %v", test.path, response.Status, response.Header)
+		}
+		if response.ContentLength != test.contentLength || len(body) != test.length {
+			t.Fatalf("%s: expected Content-Length %d and %d bytes, received %d and %d bytes", test.path, test.contentLength, test.length, response.ContentLength, len(body))
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package httpserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestInfo describes a request the Server has finished handling.
+type RequestInfo struct {
+	Method string
+	Path   string
+	// Status is the response status code, 200 if the handler wrote none.
+	Status int
+	// Duration is how long the request took to handle, including the
+	// Server's middleware.
+	Duration time.Duration
+	// BytesWritten is the size of the response body.
+	BytesWritten int64
+	// ClientIP is the client address as returned by ClientIP.
+	ClientIP string
+}
+
+// AddRequestObserver registers a function that is called with a description
+// of every request after it has been handled, including requests rejected by
+// the Server's middleware. Observers are called in the order they were added
+// on the request's goroutine, so they should return quickly. They must be
+// added before Start.
+func (s *Server) AddRequestObserver(observer func(RequestInfo)) {
+	s.observers = append(s.observers, observer)
+}
+
+// EnableSlowRequestLog calls log for every request that takes longer than
+// threshold to handle, for performance triage in services where an access log
+// would be too verbose. If log is nil each slow request is written to the
+// Server's logger. It is built on AddRequestObserver.
+func (s *Server) EnableSlowRequestLog(threshold time.Duration, log func(RequestInfo)) {
+	if log == nil {
+		log = func(info RequestInfo) {
+			s.logf("Slow request: %s %s %d %s", info.Method, info.Path, info.Status, info.Duration)
+		}
+	}
+	s.AddRequestObserver(func(info RequestInfo) {
+		if info.Duration > threshold {
+			log(info)
+		}
+	})
+}
+
+func (s *Server) observeRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &responseWriter{ResponseWriter: writer}
+		handler.ServeHTTP(recorder, request)
+		info := RequestInfo{
+			Method:       request.Method,
+			Path:         request.URL.Path,
+			Status:       recorder.statusCode(),
+			Duration:     time.Since(start),
+			BytesWritten: recorder.written,
+			ClientIP:     s.ClientIP(request),
+		}
+		for _, observer := range s.observers {
+			observer(info)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package httpserver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRequestObserver(t *testing.T) {
+	observed := make(chan RequestInfo, 10)
+	server := New(writeString("hello"))
+	server.SetMaxURLLength(20)
+	server.AddRequestObserver(func(info RequestInfo) { observed <- info })
+	base := startServer(t, server)
+	get(t, base+"/path?query")
+	get(t, base+"/a-path-that-is-far-too-long")
+	if info := <-observed; info.Method != "GET" || info.Path != "/path" || info.Status != http.StatusOK || info.BytesWritten != 5 || info.ClientIP != "127.0.0.1" || info.Duration <= 0 {
+		t.Fatalf("Unexpected request info %+v", info)
+	}
+	if info := <-observed; info.Status != http.StatusRequestURITooLong {
+		t.Fatalf("Expected the rejected request to be observed, found %+v", info)
+	}
+}
+
+func TestSlowRequestLog(t *testing.T) {
+	slow := make(chan RequestInfo, 10)
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/slow" {
+			time.Sleep(60 * time.Millisecond)
+		}
+	})
+	server.EnableSlowRequestLog(50*time.Millisecond, func(info RequestInfo) { slow <- info })
+	base := startServer(t, server)
+	get(t, base+"/fast")
+	get(t, base+"/slow")
+	get(t, base+"/fast")
+	if info := <-slow; info.Path != "/slow" || info.Duration < 60*time.Millisecond {
+		t.Fatalf("Unexpected slow request %+v", info)
+	}
+	select {
+	case info := <-slow:
+		t.Fatalf("Fast request logged as slow: %+v", info)
+	default:
+	}
+}
@@ -0,0 +1,73 @@
+package httpserver
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// SetPidFile makes the Server write its process ID to path when it starts and
+// remove it when it shuts down, including when Close or an escalated signal
+// to Run ends the process early. The file is only removed if it still holds
+// this process's ID, so a replacement process that has already written its
+// own is left alone. Start fails if the file cannot be written.
+//
+// For an upgrade, the replacement process can use SignalPidFile to ask the
+// running instance to shut down before starting in its place.
+func (s *Server) SetPidFile(path string) {
+	s.pidFile = path
+}
+
+func (s *Server) writePidFile() error {
+	if s.pidFile == "" {
+		return nil
+	}
+	pid := strconv.Itoa(os.Getpid()) + "\n"
+	if err := os.WriteFile(s.pidFile, []byte(pid), 0644); err != nil {
+		return fmt.Errorf("httpserver: writing pid file: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) removePidFile() {
+	if s.pidFile == "" {
+		return
+	}
+	if pid, err := readPidFile(s.pidFile); err != nil || pid != os.Getpid() {
+		return
+	}
+	if err := os.Remove(s.pidFile); err != nil {
+		s.logf("Failed to remove pid file: %v", err)
+	}
+}
+
+func readPidFile(path string) (int, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(contents)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("httpserver: invalid pid file %s", path)
+	}
+	return pid, nil
+}
+
+// SignalPidFile sends sig to the process whose ID is recorded in the pid file
+// at path, such as SIGTERM to ask a previous instance started with Run to
+// shut down gracefully. It returns the signalled process's ID.
+func SignalPidFile(path string, sig os.Signal) (int, error) {
+	pid, err := readPidFile(path)
+	if err != nil {
+		return 0, err
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+	if err := process.Signal(sig); err != nil {
+		return 0, err
+	}
+	return pid, nil
+}
@@ -0,0 +1,66 @@
+package httpserver
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestPidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.pid")
+	server := New(writeString("OK"))
+	server.SetQuiet(true)
+	server.SetPidFile(path)
+	startServer(t, server)
+	if pid, err := readPidFile(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("Expected pid %d, read %d: %v", os.Getpid(), pid, err)
+	}
+	<-server.Stop()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("Pid file not removed on shutdown:", err)
+	}
+}
+
+func TestPidFileReplaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.pid")
+	server := New(writeString("OK"))
+	server.SetQuiet(true)
+	server.SetPidFile(path)
+	startServer(t, server)
+	replacement := strconv.Itoa(os.Getppid())
+	if err := os.WriteFile(path, []byte(replacement), 0644); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	<-server.Stop()
+	if contents, err := os.ReadFile(path); err != nil || string(contents) != replacement {
+		t.Fatalf("Replacement pid file changed to %q: %v", contents, err)
+	}
+}
+
+func TestPidFileUnwritable(t *testing.T) {
+	server := New(writeString("OK"))
+	server.SetPidFile(filepath.Join(t.TempDir(), "missing", "server.pid"))
+	if err := server.Start("127.0.0.1:"); err == nil {
+		<-server.Stop()
+		t.Fatal("Expected Start to fail")
+	}
+	if server.IsListening() {
+		t.Fatal("Server listening after failed Start")
+	}
+}
+
+func TestSignalPidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.pid")
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if pid, err := SignalPidFile(path, syscall.Signal(0)); err != nil || pid != os.Getpid() {
+		t.Fatalf("Expected to signal %d, signalled %d: %v", os.Getpid(), pid, err)
+	}
+	os.WriteFile(path, []byte("garbage"), 0644)
+	if _, err := SignalPidFile(path, syscall.Signal(0)); err == nil {
+		t.Fatal("Expected an error for an invalid pid file")
+	}
+}
@@ -0,0 +1,151 @@
+package httpserver
+
+import (
+	"net/http"
+	"time"
+)
+
+// ReadinessState describes whether a Server is ready to serve its handler.
+type ReadinessState int32
+
+const (
+	// ReadinessStarting is the state from Start until SetReady is first
+	// called.
+	ReadinessStarting ReadinessState = iota
+	// ReadinessReady means the Server's dependencies are available.
+	ReadinessReady
+	// ReadinessNotReady means the Server was ready but has lost a
+	// dependency.
+	ReadinessNotReady
+)
+
+func (r ReadinessState) String() string {
+	switch r {
+	case ReadinessStarting:
+		return "starting"
+	case ReadinessReady:
+		return "ready"
+	case ReadinessNotReady:
+		return "not ready"
+	}
+	return "unknown"
+}
+
+// Readiness returns the Server's current readiness state. It is
+// ReadinessNotReady from the start of a pre-shutdown delay onwards, whatever
+// state was set.
+func (s *Server) Readiness() ReadinessState {
+	if s.preShutdown.Load() {
+		return ReadinessNotReady
+	}
+	return ReadinessState(s.readiness.Load())
+}
+
+// SetReady moves the Server to ReadinessReady or ReadinessNotReady. The state
+// returns to ReadinessStarting each time the Server is started.
+func (s *Server) SetReady(ready bool) {
+	if ready {
+		s.readiness.Store(int32(ReadinessReady))
+	} else {
+		s.readiness.Store(int32(ReadinessNotReady))
+	}
+}
+
+// SetStartupHandler sets a handler that serves requests in place of the
+// Server's handler while its readiness state is ReadinessStarting, so that
+// clients are not served by a partially initialized application. Intercepts
+// are still served. If handler is nil, requests receive 503 Service
+// Unavailable. Without a startup handler the Server's handler is used
+// regardless of readiness.
+func (s *Server) SetStartupHandler(handler http.Handler) {
+	if handler == nil {
+		handler = http.HandlerFunc(s.notReady)
+	}
+	s.startupHandler = handler
+}
+
+func (s *Server) serviceUnavailable(writer http.ResponseWriter, request *http.Request) {
+	s.respondError(writer, http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+}
+
+// notReady is the default startup handler, which sends the response set by
+// SetNotReadyResponse if there is one.
+func (s *Server) notReady(writer http.ResponseWriter, request *http.Request) {
+	if !s.writeNotReady(writer) {
+		s.serviceUnavailable(writer, request)
+	}
+}
+
+type notReadyResponse struct {
+	status      int
+	body        []byte
+	contentType string
+}
+
+// SetNotReadyResponse sets the response sent while the Server is not ready:
+// by the default startup handler, and by the admin listener's /readyz
+// endpoint, so that load balancers and people get a meaningful message. A
+// status of 0 means 503 Service Unavailable. Without it the startup handler
+// answers through the error responder and /readyz writes the readiness state
+// as plain text.
+func (s *Server) SetNotReadyResponse(status int, body []byte, contentType string) {
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	s.notReadyResponse = &notReadyResponse{status: status, body: body, contentType: contentType}
+}
+
+// writeNotReady writes the response set by SetNotReadyResponse, returning false
+// if there is none.
+func (s *Server) writeNotReady(writer http.ResponseWriter) bool {
+	response := s.notReadyResponse
+	if response == nil {
+		return false
+	}
+	if response.contentType != "" {
+		writer.Header().Set("Content-Type", response.contentType)
+	}
+	writer.WriteHeader(response.status)
+	writer.Write(response.body)
+	return true
+}
+
+type readinessProbe struct {
+	probe            func() error
+	successThreshold int
+	interval         time.Duration
+}
+
+// SetReadinessProbe has the Server manage its own readiness: once started,
+// it calls probe every interval, moving to ReadinessReady after
+// successThreshold consecutive successes and to ReadinessNotReady as soon as
+// a probe fails while ready. Probing stops when the Server shuts down. It must
+// be called before Start.
+func (s *Server) SetReadinessProbe(probe func() error, successThreshold int, interval time.Duration) {
+	if successThreshold < 1 {
+		successThreshold = 1
+	}
+	s.readinessProbe = &readinessProbe{probe: probe, successThreshold: successThreshold, interval: interval}
+}
+
+func (s *Server) runReadinessProbe(probe readinessProbe, done <-chan struct{}) {
+	ticker := time.NewTicker(probe.interval)
+	defer ticker.Stop()
+	successes := 0
+	for {
+		if err := probe.probe(); err != nil {
+			successes = 0
+			if s.Readiness() == ReadinessReady {
+				s.logf("Readiness probe failed, no longer ready: %v", err)
+				s.SetReady(false)
+			}
+		} else if successes++; successes >= probe.successThreshold && s.Readiness() != ReadinessReady {
+			s.SetReady(true)
+		}
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
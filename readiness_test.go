@@ -0,0 +1,105 @@
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartupHandler(t *testing.T) {
+	server := New(writeString("ready"))
+	server.SetStartupHandler(nil)
+	server.Intercept("/healthz", writeString("ok"))
+	base := startServer(t, server)
+	if state := server.Readiness(); state != ReadinessStarting {
+		t.Fatal("Expected starting, found", state)
+	}
+	if response, _ := get(t, base+"/"); response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal("Expected 503 while starting, received", response.Status)
+	}
+	if _, body := get(t, base+"/healthz"); body != "ok" {
+		t.Fatalf("Expected intercept to be served while starting, received %q", body)
+	}
+	server.SetReady(true)
+	if _, body := get(t, base+"/"); body != "ready" {
+		t.Fatalf("Expected handler once ready, received %q", body)
+	}
+	server.SetReady(false)
+	if state := server.Readiness(); state != ReadinessNotReady {
+		t.Fatal("Expected not ready, found", state)
+	}
+	if _, body := get(t, base+"/"); body != "ready" {
+		t.Fatalf("Startup handler should only be used while starting, received %q", body)
+	}
+}
+
+func TestNotReadyResponse(t *testing.T) {
+	server := New(writeString("ready"))
+	server.SetStartupHandler(nil)
+	server.SetNotReadyResponse(0, []byte(`{"error":"warming up"}`), "application/json")
+	server.EnableAdminListener("127.0.0.1:")
+	base := startServer(t, server)
+	admin := "http://" + server.companion("admin").listener.Addr().String()
+	for _, url := range []string{base + "/", admin + "/readyz"} {
+		response, body := get(t, url)
+		if response.StatusCode != http.StatusServiceUnavailable || body != `{"error":"warming up"}` {
+			t.Errorf("Expected the not ready response from %s, received %s %q", url, response.Status, body)
+		}
+		if contentType := response.Header.Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("Expected the configured content type from %s, received %q", url, contentType)
+		}
+	}
+	server.SetReady(true)
+	if _, body := get(t, base+"/"); body != "ready" {
+		t.Fatalf("Expected handler once ready, received %q", body)
+	}
+	server.SetMaintenanceMode(true, nil)
+	if response, body := get(t, base+"/"); response.StatusCode != http.StatusServiceUnavailable || strings.Contains(body, "warming up") {
+		t.Fatalf("Expected the maintenance response, received %s %q", response.Status, body)
+	}
+}
+
+func TestReadinessProbe(t *testing.T) {
+	called := make(chan struct{})
+	results := make(chan error)
+	server := New(writeString("ready"))
+	server.SetQuiet(true)
+	server.SetReadinessProbe(func() error {
+		called <- struct{}{}
+		return <-results
+	}, 2, time.Millisecond)
+	startServer(t, server)
+	<-called
+	probe := func(err error, expected ReadinessState) {
+		t.Helper()
+		results <- err
+		// The state is updated before the next probe is made.
+		<-called
+		if state := server.Readiness(); state != expected {
+			t.Fatalf("Expected %v, found %v", expected, state)
+		}
+	}
+	probe(nil, ReadinessStarting)
+	probe(nil, ReadinessReady)
+	probe(errors.New("down"), ReadinessNotReady)
+	probe(nil, ReadinessNotReady)
+	probe(nil, ReadinessReady)
+	stopped := server.Stop()
+	go func() {
+		for {
+			select {
+			case results <- nil:
+			case <-called:
+			case <-stopped:
+				return
+			}
+		}
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Probe did not stop on shutdown")
+	}
+}
@@ -0,0 +1,111 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+)
+
+// reloadChanges holds the handler and certificate set during a Reload until
+// the reloader succeeds.
+type reloadChanges struct {
+	handler     *http.HandlerFunc
+	certificate *tls.Certificate
+}
+
+// SetHandler replaces the Server's handler, and may be called while the
+// Server is running: requests already being served finish with the previous
+// handler, and new requests use handlerFunc. The replacement is served as a
+// plain handler, so the ServeMux of a Server created by NewMux no longer
+// routes requests and Handle must not be called afterwards.
+func (s *Server) SetHandler(handlerFunc http.HandlerFunc) {
+	if changes := s.reloadChanges.Load(); changes != nil {
+		changes.handler = &handlerFunc
+		return
+	}
+	s.replacedHandler.Store(&handlerFunc)
+}
+
+// routes returns the Server's handler, along with the ServeMux and file server
+// it was created with unless SetHandler has replaced it.
+func (s *Server) routes() (http.HandlerFunc, *http.ServeMux, bool) {
+	if handler := s.replacedHandler.Load(); handler != nil {
+		return *handler, nil, false
+	}
+	return s.handlerFunc, s.mux, s.fileServer
+}
+
+// ReloadCertificate loads a certificate and key from PEM files and serves it
+// to new TLS connections in place of the certificates in TLSConfig, so that a
+// renewed certificate can be picked up without restarting. If either file
+// cannot be loaded an error is returned and the current certificate is kept.
+// Configs chosen by SetTLSConfigSelector keep their own certificates. If
+// TLSConfig is nil before Start, one is created so that the Server serves TLS.
+func (s *Server) ReloadCertificate(certFile, keyFile string) error {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	if changes := s.reloadChanges.Load(); changes != nil {
+		changes.certificate = &certificate
+		return nil
+	}
+	if s.TLSConfig == nil && !s.IsListening() {
+		s.TLSConfig = &tls.Config{}
+	}
+	s.certificate.Store(&certificate)
+	return nil
+}
+
+// selectCertificate chooses from certificates as tls.Config does when
+// GetCertificate is nil.
+func selectCertificate(certificates []tls.Certificate, hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if len(certificates) == 0 {
+		return nil, errors.New("httpserver: no certificates configured")
+	}
+	if len(certificates) > 1 {
+		for i := range certificates {
+			if hello.SupportsCertificate(&certificates[i]) == nil {
+				return &certificates[i], nil
+			}
+		}
+	}
+	return &certificates[0], nil
+}
+
+// SetReloader sets the function Reload calls to re-read the Server's
+// configuration, such as on SIGHUP. It would typically load its settings and
+// then apply them with SetHandler and ReloadCertificate.
+func (s *Server) SetReloader(reloader func() error) {
+	s.reloader = reloader
+}
+
+// Reload calls the reloader set by SetReloader, one reload at a time, and
+// returns its error. The handler and certificate the reloader sets with
+// SetHandler and ReloadCertificate take effect together when it returns, and
+// are discarded if it returns an error, leaving those in use unchanged. Only
+// the handler and certificate can be reloaded: the Server's middleware and
+// other settings are fixed when it starts and read while it serves requests,
+// so a reloader must not call their setters; restart the Server to change
+// them.
+func (s *Server) Reload() error {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+	if s.reloader == nil {
+		return errors.New("httpserver: no reloader")
+	}
+	changes := &reloadChanges{}
+	s.reloadChanges.Store(changes)
+	err := s.reloader()
+	s.reloadChanges.Store(nil)
+	if err != nil {
+		return err
+	}
+	if changes.certificate != nil {
+		s.certificate.Store(changes.certificate)
+	}
+	if changes.handler != nil {
+		s.replacedHandler.Store(changes.handler)
+	}
+	return nil
+}
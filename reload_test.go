@@ -0,0 +1,125 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadHandler(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/slow" {
+			close(entered)
+			<-release
+		}
+		writer.Write([]byte("old"))
+	})
+	url := startServer(t, server)
+
+	slow := make(chan string, 1)
+	go func() {
+		response, err := http.Get(url + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		slow <- string(body)
+	}()
+	<-entered
+
+	if err := server.Reload(); err == nil {
+		t.Error("Expected an error without a reloader")
+	}
+	// A middleware setter called by a reloader must not change the
+	// middleware in use, whether the reload fails or a later one succeeds.
+	server.SetReloader(func() error {
+		server.SetHandler(writeString("broken"))
+		server.SetAllowedMethods(http.MethodPost)
+		return errors.New("bad config")
+	})
+	if err := server.Reload(); err == nil || err.Error() != "bad config" {
+		t.Error("Expected the reloader's error, got", err)
+	}
+	if response, body := get(t, url); response.StatusCode != http.StatusOK || body != "old" {
+		t.Errorf("Expected the previous handler after a failed reload, got %s %q", response.Status, body)
+	}
+
+	server.SetReloader(func() error {
+		server.SetHandler(writeString("new"))
+		return nil
+	})
+	if err := server.Reload(); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if response, body := get(t, url); response.StatusCode != http.StatusOK || body != "new" {
+		t.Errorf("Expected the new handler with the original middleware, got %s %q", response.Status, body)
+	}
+
+	close(release)
+	if body := <-slow; body != "old" {
+		t.Errorf("Expected the in-flight request to finish with the old handler, got %q", body)
+	}
+}
+
+func writeCertificate(t *testing.T, certificate tls.Certificate) (string, string) {
+	dir := t.TempDir()
+	key, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Certificate[0]}), 0o600); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	return certFile, keyFile
+}
+
+func TestReloadCertificate(t *testing.T) {
+	original := testCertificate(t, "127.0.0.1")
+	renewed := testCertificate(t, "127.0.0.1")
+	server := New(writeString("ok"))
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{original}}
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer func() { <-server.Stop() }()
+	<-server.WaitForStart()
+
+	served := func() []byte {
+		conn, err := tls.Dial("tcp", server.Address().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Raw
+	}
+	if string(served()) != string(original.Certificate[0]) {
+		t.Error("Expected the original certificate")
+	}
+	if err := server.ReloadCertificate("missing.pem", "missing.pem"); err == nil {
+		t.Error("Expected an error for missing files")
+	}
+	if string(served()) != string(original.Certificate[0]) {
+		t.Error("Expected the original certificate after a failed reload")
+	}
+	certFile, keyFile := writeCertificate(t, renewed)
+	if err := server.ReloadCertificate(certFile, keyFile); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if string(served()) != string(renewed.Certificate[0]) {
+		t.Error("Expected the reloaded certificate")
+	}
+}
@@ -0,0 +1,124 @@
+package httpserver
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// shedSamples is how many recent request latencies are kept.
+	shedSamples = 256
+	// shedMinSamples is how many recent latencies are needed before
+	// shedding can begin, so a single slow request does not trigger it.
+	shedMinSamples = 20
+	// shedSampleAge is how long a latency counts towards the p99, which lets
+	// shedding end once slow requests stop even if every request is shed.
+	shedSampleAge = 10 * time.Second
+	// shedEvaluateInterval is how often the p99 is recomputed.
+	shedEvaluateInterval = 100 * time.Millisecond
+)
+
+type latencySample struct {
+	at       time.Time
+	duration time.Duration
+}
+
+type latencyShedder struct {
+	threshold time.Duration
+	ratio     float64
+	maxAge    time.Duration
+	interval  time.Duration
+	requests  atomic.Int64
+	shedding  atomic.Bool
+
+	mutex     sync.Mutex
+	samples   []latencySample
+	next      int
+	evaluated time.Time
+}
+
+// EnableLatencyShedding has the Server shed load while it is slow: when the
+// p99 latency of recent requests exceeds p99Threshold, shedRatio of new
+// requests, between 0 and 1, receive 503 Service Unavailable through the
+// error responder without reaching the handler. The p99 is taken over the
+// latencies of the last ten seconds, once there are at least 20, so shedding
+// ends by itself once requests are fast again. Shed requests are still logged
+// and observed, but do not count towards the p99. Intercepts are subject to
+// shedding too.
+func (s *Server) EnableLatencyShedding(p99Threshold time.Duration, shedRatio float64) {
+	s.latencyShedder = &latencyShedder{
+		threshold: p99Threshold,
+		ratio:     min(max(shedRatio, 0), 1),
+		maxAge:    shedSampleAge,
+		interval:  shedEvaluateInterval,
+	}
+}
+
+func (s *Server) shedOnLatency(shedder *latencyShedder, respond ErrorResponder, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		s.evaluateLatency(shedder, start)
+		if shedder.shedding.Load() && shedder.shed() {
+			respond(writer, http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+			return
+		}
+		defer func() {
+			shedder.record(start, time.Since(start))
+		}()
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// shed reports whether the next request is one of the fraction to shed.
+func (l *latencyShedder) shed() bool {
+	n := float64(l.requests.Add(1))
+	return math.Floor(n*l.ratio) > math.Floor((n-1)*l.ratio)
+}
+
+func (l *latencyShedder) record(at time.Time, duration time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	sample := latencySample{at: at, duration: duration}
+	if len(l.samples) < shedSamples {
+		l.samples = append(l.samples, sample)
+		return
+	}
+	l.samples[l.next] = sample
+	l.next = (l.next + 1) % shedSamples
+}
+
+// evaluateLatency recomputes the p99 of recent requests, at most once per
+// interval, and starts or stops shedding.
+func (s *Server) evaluateLatency(shedder *latencyShedder, now time.Time) {
+	shedder.mutex.Lock()
+	defer shedder.mutex.Unlock()
+	if now.Sub(shedder.evaluated) < shedder.interval {
+		return
+	}
+	shedder.evaluated = now
+	var durations []time.Duration
+	for _, sample := range shedder.samples {
+		if now.Sub(sample.at) <= shedder.maxAge {
+			durations = append(durations, sample.duration)
+		}
+	}
+	var p99 time.Duration
+	if len(durations) >= shedMinSamples {
+		slices.Sort(durations)
+		p99 = durations[int(math.Ceil(float64(len(durations))*0.99))-1]
+	}
+	slow := p99 > shedder.threshold
+	if slow == shedder.shedding.Load() {
+		return
+	}
+	shedder.shedding.Store(slow)
+	if slow {
+		s.logf("Request latency p99 of %s exceeds %s, shedding %.0f%% of requests", p99, shedder.threshold, shedder.ratio*100)
+	} else {
+		s.logf("Request latency recovered, no longer shedding requests")
+	}
+}
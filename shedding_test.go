@@ -0,0 +1,44 @@
+package httpserver
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLatencyShedding(t *testing.T) {
+	var slow atomic.Bool
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		if slow.Load() {
+			time.Sleep(30 * time.Millisecond)
+		}
+		writer.Write([]byte("ok"))
+	})
+	server.SetQuiet(true)
+	server.EnableLatencyShedding(20*time.Millisecond, 0.5)
+	server.latencyShedder.maxAge = time.Second
+	server.latencyShedder.interval = 0
+	base := startServer(t, server)
+	shed := func(requests int) int {
+		count := 0
+		for i := 0; i < requests; i++ {
+			if response, _ := get(t, base+"/"); response.StatusCode == http.StatusServiceUnavailable {
+				count++
+			}
+		}
+		return count
+	}
+	if count := shed(30); count != 0 {
+		t.Fatalf("Expected no shedding while fast, shed %d", count)
+	}
+	slow.Store(true)
+	if count := shed(60); count < 10 {
+		t.Fatalf("Expected shedding once slow, shed %d of 60", count)
+	}
+	slow.Store(false)
+	time.Sleep(1100 * time.Millisecond)
+	if count := shed(30); count != 0 {
+		t.Fatalf("Expected shedding to stop once fast again, shed %d", count)
+	}
+}
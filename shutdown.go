@@ -0,0 +1,418 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SetDrainProgressHandler sets a function that is called periodically while
+// the Server is waiting for in-flight requests to complete during shutdown.
+// It is passed the number of requests still in flight and is no longer called
+// once the drain completes. See SetDrainProgressInterval.
+func (s *Server) SetDrainProgressHandler(drainProgressHandler func(inFlight int)) {
+	s.drainProgressHandler = drainProgressHandler
+}
+
+// SetDrainProgressInterval sets how often the drain progress handler is
+// called. The default is one second.
+func (s *Server) SetDrainProgressInterval(interval time.Duration) {
+	s.drainProgressInterval = interval
+}
+
+// reportEvery calls report every interval from its own goroutine, and returns
+// a function that stops reporting and waits for the goroutine to exit.
+func reportEvery(interval time.Duration, report func()) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				report()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// startDrainProgress starts reporting drain progress, if enabled, and returns
+// a function that stops reporting and waits for the reporter to exit.
+func (s *Server) startDrainProgress() (stop func()) {
+	if s.drainProgressHandler == nil {
+		return func() {}
+	}
+	interval := s.drainProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return reportEvery(interval, func() { s.drainProgressHandler(s.InFlight()) })
+}
+
+// SetDrainLogInterval makes the Server log the number of requests still in
+// flight and the time elapsed every interval while it drains them during
+// shutdown, so that operators can see a long drain progressing. Zero, the
+// default, disables the log lines.
+func (s *Server) SetDrainLogInterval(interval time.Duration) {
+	s.drainLogInterval = interval
+}
+
+// startDrainLog starts logging drain progress, if enabled, and returns a
+// function that stops logging and waits for the logger to exit.
+func (s *Server) startDrainLog() (stop func()) {
+	if s.drainLogInterval <= 0 {
+		return func() {}
+	}
+	start := time.Now()
+	return reportEvery(s.drainLogInterval, func() {
+		s.logf("Draining: %d in flight, %s elapsed", s.InFlight(), time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// SetShutdownTimeout bounds how long Stop waits for stream closers and
+// in-flight requests before giving up on the drain. Zero, the default, waits
+// indefinitely.
+func (s *Server) SetShutdownTimeout(timeout time.Duration) {
+	s.shutdownTimeout = timeout
+}
+
+// drainContext returns the context that bounds shutdown: the context passed
+// to StopContext, context.Background for Stop, limited by the shutdown timeout
+// if one is set, except for StopAfterInFlight, and cancelled by Close.
+func (s *Server) drainContext() (context.Context, context.CancelFunc) {
+	s.mutex.Lock()
+	parent, afterInFlight := s.stopContext, s.afterInFlight
+	s.mutex.Unlock()
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if s.shutdownTimeout > 0 && !afterInFlight {
+		ctx, cancel = context.WithTimeout(parent, s.shutdownTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	stop := context.AfterFunc(s.closeCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// RegisterStream registers a function that ends a long-lived response, such
+// as a Server-Sent Events stream, during shutdown. http.Server.Shutdown waits
+// for active responses to complete, so a stream left open holds the drain
+// until the shutdown timeout expires. When the Server stops, registered
+// closers are called concurrently before the drain begins, with a context
+// that expires with the shutdown timeout; each should signal its handler to
+// send any final event and return, and may wait for it to do so. Call the
+// returned function when the stream ends on its own.
+func (s *Server) RegisterStream(closer func(ctx context.Context)) (unregister func()) {
+	s.streamsMutex.Lock()
+	defer s.streamsMutex.Unlock()
+	if s.streams == nil {
+		s.streams = make(map[uint64]func(context.Context))
+	}
+	s.nextStream++
+	id := s.nextStream
+	s.streams[id] = closer
+	return func() {
+		s.streamsMutex.Lock()
+		defer s.streamsMutex.Unlock()
+		delete(s.streams, id)
+	}
+}
+
+func (s *Server) closeStreams(ctx context.Context) {
+	s.streamsMutex.Lock()
+	closers := make([]func(context.Context), 0, len(s.streams))
+	for _, closer := range s.streams {
+		closers = append(closers, closer)
+	}
+	s.streamsMutex.Unlock()
+	if len(closers) == 0 {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, closer := range closers {
+		wg.Add(1)
+		go func(closer func(context.Context)) {
+			defer wg.Done()
+			closer(ctx)
+		}(closer)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// SetDrainDeadlines sets separate limits on how long shutdown waits for
+// ordinary connections and for streaming connections, those classified with
+// MarkStream, to finish, so idle-prone request/response traffic can be cut
+// quickly while streams get longer to end cleanly. When a deadline passes,
+// connections of that class still open are closed, interrupting their
+// requests. Deadlines are measured from the start of the drain and a zero
+// deadline, the default, leaves that class to the shutdown timeout, which
+// still bounds the whole drain.
+func (s *Server) SetDrainDeadlines(connDeadline, streamDeadline time.Duration) {
+	s.connDrainDeadline = connDeadline
+	s.streamDrainDeadline = streamDeadline
+}
+
+// startDrainDeadlines closes connections as their class's drain deadline
+// passes, and returns a function that stops doing so.
+func (s *Server) startDrainDeadlines() (stop func()) {
+	var timers []*time.Timer
+	if s.connDrainDeadline > 0 {
+		timers = append(timers, time.AfterFunc(s.connDrainDeadline, func() { s.closeConnsByClass(false) }))
+	}
+	if s.streamDrainDeadline > 0 {
+		timers = append(timers, time.AfterFunc(s.streamDrainDeadline, func() { s.closeConnsByClass(true) }))
+	}
+	return func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}
+}
+
+// ShutdownContext returns a context that is cancelled when the Server begins
+// shutting down. It is valid after Start.
+func (s *Server) ShutdownContext() context.Context {
+	return s.shutdownCtx
+}
+
+// Go runs fn in a goroutine tied to the Server's lifetime. fn is passed the
+// ShutdownContext and should return once it is cancelled; Stop and Wait do not
+// complete until every such goroutine has returned or the shutdown timeout has
+// expired. Go must be called after Start.
+func (s *Server) Go(fn func(ctx context.Context)) {
+	s.tasks.Add(1)
+	ctx := s.shutdownCtx
+	go func() {
+		defer s.tasks.Done()
+		fn(ctx)
+	}()
+}
+
+// SetShutdownBarrier sets a function that shutdown waits on after in-flight
+// requests and Go tasks have finished, for conditions that must hold before
+// the Server is considered stopped, such as a replica confirming it has taken
+// over leadership. It is passed the shutdown context, which expires with the
+// shutdown timeout or the context given to StopContext, and Wait is not
+// released until it returns. An error it returns is reported by LastError,
+// alongside any error from the drain.
+func (s *Server) SetShutdownBarrier(barrier func(ctx context.Context) error) {
+	s.shutdownBarrier = barrier
+}
+
+func (s *Server) waitForBarrier(ctx context.Context) {
+	if s.shutdownBarrier == nil {
+		return
+	}
+	if err := s.shutdownBarrier(ctx); err != nil {
+		err = fmt.Errorf("httpserver: shutdown barrier: %w", err)
+		if last := s.LastError(); last != nil {
+			err = errors.Join(last, err)
+		}
+		s.setError(err)
+	}
+}
+
+func (s *Server) waitForTasks(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.tasks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// ErrShutdownForced is reported by LastError when the drain was abandoned,
+// because the shutdown timeout or the context passed to StopContext expired,
+// and the connections still open were closed. The error also wraps the
+// context's error.
+var ErrShutdownForced = errors.New("httpserver: drain abandoned, connections closed")
+
+// ErrShutdownInProgress is returned by CancelStop once shutdown has progressed
+// too far to be cancelled.
+var ErrShutdownInProgress = errors.New("httpserver: shutdown already in progress")
+
+// SetPreShutdownDelay makes Stop keep serving for delay before shutting down,
+// while Readiness reports ReadinessNotReady, so that load balancers polling a
+// readiness check stop sending new requests before the listener closes. The
+// delay can be abandoned with CancelStop, and Close cuts it short. Zero, the
+// default, begins shutting down immediately.
+func (s *Server) SetPreShutdownDelay(delay time.Duration) {
+	s.preShutdownDelay = delay
+}
+
+// CancelStop abandons a Stop that is still waiting out the pre-shutdown
+// delay, returning the Server to running as if Stop had not been called: Wait
+// is not released and readiness reverts to the state last set. It returns nil
+// if no stop is pending, ErrNotRunning if the Server is not running, and
+// ErrShutdownInProgress once the delay has ended and shutdown has begun.
+func (s *Server) CancelStop() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch {
+	case s.preShutdownTimer != nil:
+		s.preShutdownTimer.Stop()
+		s.preShutdownTimer = nil
+		s.stopContext = nil
+		s.stopReason = ShutdownNone
+		s.preShutdown.Store(false)
+		return nil
+	case s.listening:
+		return nil
+	case s.wait != nil:
+		select {
+		case <-s.wait:
+		default:
+			return ErrShutdownInProgress
+		}
+	}
+	return ErrNotRunning
+}
+
+// SetCloseIdleOnShutdown disables keep-alives as soon as the Server begins
+// shutting down, before stream closers run, rather than when the drain
+// begins. Idle keep-alive connections are closed immediately and responses
+// completed in the meantime carry Connection: close, so clients stop reusing
+// connections while streams are still ending.
+func (s *Server) SetCloseIdleOnShutdown(closeIdle bool) {
+	s.closeIdleOnShutdown = closeIdle
+}
+
+func (s *Server) shutdown() {
+	if s.closeIdleOnShutdown {
+		s.server.SetKeepAlivesEnabled(false)
+	}
+	s.cancelShutdownContext()
+	ctx, cancel := s.drainContext()
+	defer cancel()
+	s.mutex.Lock()
+	afterInFlight := s.afterInFlight
+	s.mutex.Unlock()
+	if !afterInFlight {
+		s.closeStreams(ctx)
+	}
+	closeCompanions := s.shutdownCompanions(ctx)
+	stopDrainProgress := s.startDrainProgress()
+	stopDrainLog := s.startDrainLog()
+	stopDrainDeadlines := func() {}
+	if !afterInFlight {
+		stopDrainDeadlines = s.startDrainDeadlines()
+	}
+	err := s.server.Shutdown(ctx)
+	stopDrainDeadlines()
+	if err != nil {
+		// Connections still open when the drain is abandoned are closed
+		// rather than left to finish on their own.
+		s.server.Close()
+		if s.closeCtx.Err() == nil {
+			s.setError(fmt.Errorf("%w: %w", ErrShutdownForced, err))
+		}
+	}
+	stopDrainLog()
+	stopDrainProgress()
+	closeCompanions()
+	if s.accessLog != nil {
+		if err := s.accessLog.close(); err != nil {
+			s.logf("Failed to close access log: %v", err)
+		}
+	}
+	s.waitForTasks(ctx)
+	s.waitForBarrier(ctx)
+	s.background.Wait()
+	s.cancelBaseContext()
+	s.mutex.Lock()
+	s.closeListenerFile()
+	s.mutex.Unlock()
+	s.removePidFile()
+}
+
+// goBackground runs fn in a goroutine bound to the Server's lifetime. done is
+// closed when the Server begins shutting down, and shutdown waits for fn to
+// return before releasing Wait.
+func (s *Server) goBackground(fn func(done <-chan struct{})) {
+	s.background.Add(1)
+	quit := s.quit
+	go func() {
+		defer s.background.Done()
+		fn(quit)
+	}()
+}
+
+// ShutdownReason records what initiated a Server's shutdown.
+type ShutdownReason int
+
+const (
+	// ShutdownNone means the Server has not begun shutting down since it was
+	// last started.
+	ShutdownNone ShutdownReason = iota
+	// ShutdownStop means Stop or StopContext was called.
+	ShutdownStop
+	// ShutdownClose means Close was called.
+	ShutdownClose
+	// ShutdownSignal means Run received a shutdown signal.
+	ShutdownSignal
+	// ShutdownContext means the context passed to RunGroup was done.
+	ShutdownContext
+	// ShutdownServeError means RunGroup stopped the Server because it failed
+	// to serve.
+	ShutdownServeError
+	// ShutdownTrigger means a channel passed to StopOn fired.
+	ShutdownTrigger
+	// ShutdownIdle means the idle period set by EnableIdleShutdown passed.
+	ShutdownIdle
+)
+
+func (r ShutdownReason) String() string {
+	switch r {
+	case ShutdownNone:
+		return "none"
+	case ShutdownStop:
+		return "stop"
+	case ShutdownClose:
+		return "close"
+	case ShutdownSignal:
+		return "signal"
+	case ShutdownContext:
+		return "context"
+	case ShutdownServeError:
+		return "serve error"
+	case ShutdownTrigger:
+		return "trigger"
+	case ShutdownIdle:
+		return "idle"
+	}
+	return "unknown reason"
+}
+
+// StopReason returns what initiated the Server's shutdown, for post-mortem
+// logging once Wait is released. Only the first trigger is recorded, so a
+// Close that abandons the drain of a Stop leaves the reason as ShutdownStop.
+// It is ShutdownNone while the Server is running.
+func (s *Server) StopReason() ShutdownReason {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.stopReason
+}
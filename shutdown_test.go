@@ -0,0 +1,536 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisterStream(t *testing.T) {
+	var server *Server
+	server = New(func(writer http.ResponseWriter, request *http.Request) {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		unregister := server.RegisterStream(func(ctx context.Context) {
+			close(stop)
+			<-done
+		})
+		defer unregister()
+		writer.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(writer, "event: hello\n\n")
+		writer.(http.Flusher).Flush()
+		<-stop
+		fmt.Fprint(writer, "event: shutdown\n\n")
+		writer.(http.Flusher).Flush()
+		close(done)
+	})
+	server.SetShutdownTimeout(5 * time.Second)
+	base := startServer(t, server)
+	response, err := http.Get(base + "/events")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer response.Body.Close()
+	reader := bufio.NewReader(response.Body)
+	if line, _ := reader.ReadString('\n'); line != "event: hello\n" {
+		t.Fatalf("Unexpected event %q", line)
+	}
+	start := time.Now()
+	wait := server.Stop()
+	var events []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		if strings.HasPrefix(line, "event:") {
+			events = append(events, line)
+		}
+	}
+	<-wait
+	if len(events) != 1 || events[0] != "event: shutdown\n" {
+		t.Fatal("Unexpected events after shutdown:", events)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatal("Stream held the drain open for", elapsed)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		close(started)
+		time.Sleep(5 * time.Second)
+	})
+	server.SetShutdownTimeout(50 * time.Millisecond)
+	base := startServer(t, server)
+	result := make(chan error, 1)
+	go func() {
+		_, err := http.Get(base + "/hang")
+		result <- err
+	}()
+	<-started
+	select {
+	case <-server.Stop():
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown timeout not applied")
+	}
+	if !errors.Is(server.LastError(), context.DeadlineExceeded) || !errors.Is(server.LastError(), ErrShutdownForced) {
+		t.Fatal("Expected a forced shutdown after the deadline, received", server.LastError())
+	}
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Fatal("Expected the hung request's connection to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Hung request's connection left open after the deadline")
+	}
+}
+
+func TestStopContext(t *testing.T) {
+	started := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		close(started)
+		time.Sleep(5 * time.Second)
+	})
+	base := startServer(t, server)
+	go http.Get(base + "/hang")
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	wait := server.StopContext(ctx)
+	if again := server.Stop(); again != wait {
+		t.Fatal("Expected repeated stops to return the same channel")
+	}
+	select {
+	case <-wait:
+	case <-time.After(time.Second):
+		t.Fatal("Stop context deadline not applied")
+	}
+	if !errors.Is(server.LastError(), context.DeadlineExceeded) {
+		t.Fatal("Expected deadline exceeded, received", server.LastError())
+	}
+	<-server.StopContext(context.Background())
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {})
+	select {
+	case <-server.Stop():
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked on a Server that was never started")
+	}
+}
+
+func TestStopOn(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {})
+	if err := server.StopOn(make(chan struct{})); err != ErrNotRunning {
+		t.Fatal("Expected ErrNotRunning before Start, received", err)
+	}
+	startServer(t, server)
+	trigger := make(chan struct{})
+	server.StopOn(make(chan struct{}))
+	server.StopOn(trigger)
+	select {
+	case <-server.Wait():
+		t.Fatal("Server stopped before the trigger fired")
+	default:
+	}
+	trigger <- struct{}{}
+	select {
+	case <-server.Wait():
+	case <-time.After(time.Second):
+		t.Fatal("Server not stopped by trigger")
+	}
+
+	startServer(t, server)
+	server.StopOn(make(chan struct{}))
+	if !stopOnRunning() {
+		t.Fatal("StopOn goroutine not found")
+	}
+	<-server.Stop()
+	deadline := time.Now().Add(time.Second)
+	for stopOnRunning() {
+		if time.Now().After(deadline) {
+			t.Fatal("StopOn goroutine still running after the Server stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// stopOnRunning reports whether any goroutine started by StopOn is running.
+func stopOnRunning() bool {
+	buffer := make([]byte, 1<<20)
+	return strings.Contains(string(buffer[:runtime.Stack(buffer, true)]), "(*Server).StopOn.func1")
+}
+
+func TestGo(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {})
+	startServer(t, server)
+	finished := make(chan struct{})
+	server.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		close(finished)
+	})
+	<-server.Stop()
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Wait returned before the goroutine finished")
+	}
+}
+
+func TestGoShutdownTimeout(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {})
+	server.SetShutdownTimeout(50 * time.Millisecond)
+	startServer(t, server)
+	server.Go(func(ctx context.Context) {
+		time.Sleep(5 * time.Second)
+	})
+	select {
+	case <-server.Stop():
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown timeout not applied to goroutines")
+	}
+}
+
+func TestCloseIdleOnShutdown(t *testing.T) {
+	for _, closeIdle := range []bool{false, true} {
+		server := New(writeString("OK"))
+		server.SetCloseIdleOnShutdown(closeIdle)
+		release := make(chan struct{})
+		server.RegisterStream(func(ctx context.Context) { <-release })
+		base := startServer(t, server)
+		conn, err := net.Dial("tcp", base[len("http://"):])
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n")
+		reader := bufio.NewReader(conn)
+		response, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		ioutil.ReadAll(response.Body)
+		wait := server.Stop()
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err = reader.ReadByte()
+		closed := err == io.EOF
+		close(release)
+		<-wait
+		conn.Close()
+		if closed != closeIdle {
+			t.Fatalf("Expected idle connection closed before the drain to be %v, read returned %v", closeIdle, err)
+		}
+	}
+}
+
+func TestStopFromHandler(t *testing.T) {
+	var server *Server
+	server = New(func(writer http.ResponseWriter, request *http.Request) {
+		server.Stop()
+		// Give the drain a chance to start while the request is in flight.
+		time.Sleep(10 * time.Millisecond)
+		writer.Write([]byte("shutting down"))
+	})
+	base := startServer(t, server)
+	if _, body := get(t, base+"/admin/shutdown"); body != "shutting down" {
+		t.Fatalf("Unexpected response %q", body)
+	}
+	select {
+	case <-server.Wait():
+	case <-time.After(time.Second):
+		t.Fatal("Server did not stop")
+	}
+}
+
+func TestStopWithoutTimeoutWaitsForRequests(t *testing.T) {
+	entered := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		close(entered)
+		time.Sleep(200 * time.Millisecond)
+		writer.Write([]byte("complete"))
+	})
+	base := startServer(t, server)
+	result := make(chan string, 1)
+	go func() {
+		_, body := get(t, base+"/")
+		result <- body
+	}()
+	<-entered
+	<-server.Stop()
+	if body := <-result; body != "complete" {
+		t.Fatalf("Expected the request to complete, received %q", body)
+	}
+	if server.LastError() != nil {
+		t.Fatal("Unexpected error:", server.LastError())
+	}
+}
+
+func TestStopAfterInFlight(t *testing.T) {
+	entered := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		close(entered)
+		time.Sleep(300 * time.Millisecond)
+		writer.Write([]byte("complete"))
+	})
+	server.SetShutdownTimeout(50 * time.Millisecond)
+	server.SetPreShutdownDelay(time.Hour)
+	base := startServer(t, server)
+	address := server.Address().String()
+	result := make(chan string, 1)
+	go func() {
+		_, body := get(t, base+"/")
+		result <- body
+	}()
+	<-entered
+	stopped := server.StopAfterInFlight()
+	for deadline := time.Now().Add(100 * time.Millisecond); ; {
+		conn, err := net.Dial("tcp", address)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("Expected new connections to be refused")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("Stopped before the in-flight request finished")
+	default:
+	}
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not complete after the in-flight request")
+	}
+	if body := <-result; body != "complete" {
+		t.Fatalf("Expected the request to complete, received %q", body)
+	}
+	if server.LastError() != nil {
+		t.Fatal("Unexpected error:", server.LastError())
+	}
+}
+
+func TestShutdownBarrier(t *testing.T) {
+	confirmed := make(chan struct{})
+	entered := make(chan struct{})
+	server := New(writeString("ok"))
+	server.SetShutdownTimeout(time.Second)
+	server.SetShutdownBarrier(func(ctx context.Context) error {
+		close(entered)
+		select {
+		case <-confirmed:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	startServer(t, server)
+	wait := server.Stop()
+	<-entered
+	select {
+	case <-wait:
+		t.Fatal("Wait released before the barrier returned")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(confirmed)
+	select {
+	case <-wait:
+	case <-time.After(time.Second):
+		t.Fatal("Wait not released after the barrier returned")
+	}
+	if err := server.LastError(); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	server.SetShutdownTimeout(50 * time.Millisecond)
+	server.SetShutdownBarrier(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	startServer(t, server)
+	<-server.Stop()
+	if err := server.LastError(); !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "shutdown barrier") {
+		t.Fatal("Expected the barrier's error, received", err)
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	for expected, stop := range map[ShutdownReason]func(*Server) <-chan struct{}{
+		ShutdownStop:  (*Server).Stop,
+		ShutdownClose: (*Server).Close,
+		ShutdownTrigger: func(server *Server) <-chan struct{} {
+			trigger := make(chan struct{})
+			server.StopOn(trigger)
+			close(trigger)
+			return server.Wait()
+		},
+	} {
+		server := New(writeString("OK"))
+		server.SetQuiet(true)
+		startServer(t, server)
+		if reason := server.StopReason(); reason != ShutdownNone {
+			t.Fatal("Expected no shutdown reason while running, found", reason)
+		}
+		<-stop(server)
+		if reason := server.StopReason(); reason != expected {
+			t.Errorf("Expected shutdown reason %s, found %s", expected, reason)
+		}
+		server.Close()
+		if reason := server.StopReason(); reason != expected {
+			t.Errorf("Close after shutdown replaced reason %s with %s", expected, reason)
+		}
+	}
+}
+
+func TestPreShutdownDelay(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/block" {
+			entered <- struct{}{}
+			<-release
+		}
+		writer.Write([]byte("OK"))
+	})
+	server.SetQuiet(true)
+	server.SetPreShutdownDelay(100 * time.Millisecond)
+	base := startServer(t, server)
+	server.SetReady(true)
+
+	wait := server.Stop()
+	if server.Readiness() != ReadinessNotReady {
+		t.Fatal("Expected not ready during the pre-shutdown delay, found", server.Readiness())
+	}
+	if _, body := get(t, base+"/"); body != "OK" {
+		t.Fatal("Expected requests to be served during the delay, received", body)
+	}
+	if err := server.CancelStop(); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if server.Readiness() != ReadinessReady || server.StopReason() != ShutdownNone {
+		t.Fatal("Stop not cancelled:", server.Readiness(), server.StopReason())
+	}
+	select {
+	case <-wait:
+		t.Fatal("Server stopped after CancelStop")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if _, body := get(t, base+"/"); body != "OK" {
+		t.Fatal("Unexpected body:", body)
+	}
+
+	go http.Get(base + "/block")
+	<-entered
+	start := time.Now()
+	wait = server.Stop()
+	for server.IsListening() {
+		time.Sleep(time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatal("Shutdown began before the delay elapsed:", elapsed)
+	}
+	if err := server.CancelStop(); err != ErrShutdownInProgress {
+		t.Fatal("Expected ErrShutdownInProgress, received", err)
+	}
+	close(release)
+	<-wait
+	if err := server.CancelStop(); err != ErrNotRunning {
+		t.Fatal("Expected ErrNotRunning, received", err)
+	}
+
+	startServer(t, server)
+	server.Stop()
+	select {
+	case <-server.Close():
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("Close did not cut the pre-shutdown delay short")
+	}
+}
+
+func TestDrainDeadlines(t *testing.T) {
+	entered := make(chan struct{}, 2)
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/stream" && !MarkStream(request.Context()) {
+			t.Error("Request context not from a Server")
+		}
+		entered <- struct{}{}
+		<-request.Context().Done()
+	})
+	server.SetQuiet(true)
+	server.SetDrainDeadlines(50*time.Millisecond, 300*time.Millisecond)
+	base := startServer(t, server)
+	ended := make(chan string, 2)
+	for _, path := range []string{"/plain", "/stream"} {
+		go func() {
+			http.Get(base + path)
+			ended <- path
+		}()
+	}
+	<-entered
+	<-entered
+	start := time.Now()
+	wait := server.Stop()
+	if path := <-ended; path != "/plain" || time.Since(start) > 250*time.Millisecond {
+		t.Fatalf("Expected /plain to be cut off first, %s ended after %s", path, time.Since(start))
+	}
+	if path := <-ended; path != "/stream" || time.Since(start) < 250*time.Millisecond {
+		t.Fatalf("Expected /stream to get its own deadline, %s ended after %s", path, time.Since(start))
+	}
+	select {
+	case <-wait:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not complete after the drain deadlines")
+	}
+	if MarkStream(context.Background()) {
+		t.Fatal("Marked a context that has no connection")
+	}
+}
+
+func TestDrainLogInterval(t *testing.T) {
+	started := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		close(started)
+		time.Sleep(250 * time.Millisecond)
+		writer.Write([]byte("OK"))
+	})
+	var buffer bytes.Buffer
+	server.SetLogger(log.New(&buffer, "", 0))
+	server.SetDrainLogInterval(50 * time.Millisecond)
+	base := startServer(t, server)
+	go http.Get(base + "/slow")
+	<-started
+	<-server.Stop()
+	pattern := regexp.MustCompile(`^Draining: [01] in flight, \d+ms elapsed$`)
+	var lines int
+	for _, line := range strings.Split(buffer.String(), "\n") {
+		if strings.HasPrefix(line, "Draining") {
+			if !pattern.MatchString(line) {
+				t.Fatalf("Unexpected drain log line %q", line)
+			}
+			if strings.HasPrefix(line, "Draining: 1 ") {
+				lines++
+			}
+		}
+	}
+	if lines < 2 {
+		t.Fatalf("Expected periodic drain log lines, found %d in %q", lines, buffer.String())
+	}
+}
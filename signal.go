@@ -0,0 +1,111 @@
+package httpserver
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// SignalAction is what Run does when it receives a shutdown signal.
+type SignalAction int
+
+const (
+	// SignalStop begins a graceful shutdown, as with Stop.
+	SignalStop SignalAction = iota
+	// SignalClose closes the Server immediately, as with Close.
+	SignalClose
+	// SignalExit exits the process with status 1.
+	SignalExit
+)
+
+func (a SignalAction) String() string {
+	switch a {
+	case SignalStop:
+		return "stopping"
+	case SignalClose:
+		return "closing"
+	case SignalExit:
+		return "exiting"
+	}
+	return "unknown action"
+}
+
+var defaultSignalEscalation = []SignalAction{SignalStop, SignalClose, SignalExit}
+
+// SetSignalEscalation sets the actions Run takes for successive shutdown
+// signals: the first signal triggers actions[0], the second actions[1], and so
+// on, with the last action repeated for any further signals. The default is
+// SignalStop, SignalClose, SignalExit.
+func (s *Server) SetSignalEscalation(actions ...SignalAction) {
+	s.signalEscalation = actions
+}
+
+// Run starts the Server on address and blocks until it has shut down,
+// handling SIGINT and SIGTERM with the escalation set by SetSignalEscalation.
+// It returns the error from Start, or the Server's LastError once it stops.
+func (s *Server) Run(address string) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	return s.runSignals(address, signals)
+}
+
+func (s *Server) runSignals(address string, signals <-chan os.Signal) error {
+	if err := s.Start(address); err != nil {
+		return err
+	}
+	escalation := s.signalEscalation
+	if len(escalation) == 0 {
+		escalation = defaultSignalEscalation
+	}
+	wait := s.Wait()
+	for received := 0; ; received++ {
+		select {
+		case sig := <-signals:
+			action := escalation[min(received, len(escalation)-1)]
+			s.logf("Received %s, %s", sig, action)
+			switch action {
+			case SignalStop:
+				s.stop(context.Background(), ShutdownSignal)
+			case SignalClose:
+				s.close(ShutdownSignal)
+			case SignalExit:
+				exit := s.exit
+				if exit == nil {
+					exit = os.Exit
+				}
+				s.removePidFile()
+				exit(1)
+			}
+		case <-wait:
+			return s.LastError()
+		}
+	}
+}
+
+// RunGroup starts the Server on address and blocks until ctx is done, then
+// shuts down gracefully. It is intended to be passed to errgroup.Group.Go
+// with the group's context, so that the Server stops with the rest of the
+// group:
+//
+//	g.Go(func() error { return s.RunGroup(ctx, ":8080") })
+//
+// If the Server stops serving because of an error, it is shut down and the
+// error is returned, cancelling the group. Otherwise the Server's LastError
+// after shutdown is returned, which is nil after a clean drain.
+func (s *Server) RunGroup(ctx context.Context, address string) error {
+	if err := s.Start(address); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		<-s.stop(context.Background(), ShutdownContext)
+	case <-s.failed:
+		err := s.LastError()
+		<-s.stop(context.Background(), ShutdownServeError)
+		return err
+	case <-s.Wait():
+	}
+	return s.LastError()
+}
@@ -0,0 +1,134 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func waitListening(server *Server) {
+	for !server.IsListening() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRunSignalEscalation(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		close(entered)
+		<-release
+	})
+	server.SetQuiet(true)
+	exited := make(chan int, 1)
+	server.exit = func(code int) { exited <- code }
+	server.SetSignalEscalation(SignalStop, SignalExit)
+	signals := make(chan os.Signal)
+	result := make(chan error, 1)
+	go func() { result <- server.runSignals("127.0.0.1:", signals) }()
+	waitListening(server)
+	go http.Get("http://" + server.Address().String() + "/")
+	<-entered
+
+	signals <- syscall.SIGTERM
+	select {
+	case <-server.Wait():
+		t.Fatal("Server should be draining the blocked request")
+	case <-time.After(50 * time.Millisecond):
+	}
+	signals <- syscall.SIGTERM
+	if code := <-exited; code != 1 {
+		t.Fatal("Expected exit status 1, found", code)
+	}
+}
+
+func TestRunSignalClose(t *testing.T) {
+	entered := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		close(entered)
+		<-request.Context().Done()
+	})
+	server.SetQuiet(true)
+	signals := make(chan os.Signal)
+	result := make(chan error, 1)
+	go func() { result <- server.runSignals("127.0.0.1:", signals) }()
+	waitListening(server)
+	go http.Get("http://" + server.Address().String() + "/")
+	<-entered
+
+	signals <- syscall.SIGINT
+	signals <- syscall.SIGINT
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not interrupt the drain")
+	}
+	if reason := server.StopReason(); reason != ShutdownSignal {
+		t.Fatal("Expected signal shutdown reason, found", reason)
+	}
+}
+
+func TestRunGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := New(writeString("OK"))
+	server.SetQuiet(true)
+	result := make(chan error, 1)
+	go func() { result <- server.RunGroup(ctx, "127.0.0.1:") }()
+	waitListening(server)
+	get(t, "http://"+server.Address().String()+"/")
+	cancel()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RunGroup did not return after cancellation")
+	}
+	if reason := server.StopReason(); reason != ShutdownContext {
+		t.Fatal("Expected context shutdown reason, found", reason)
+	}
+}
+
+func TestRunGroupServeError(t *testing.T) {
+	fatal := errors.New("fatal")
+	server := New(writeString("OK"))
+	server.SetQuiet(true)
+	server.SetListenerFactory(func(address string) (net.Listener, error) {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		return &flakyListener{Listener: listener, errs: []error{fatal}}, nil
+	})
+	server.SetAcceptErrorHandler(func(err error) bool { return false })
+	select {
+	case err := <-runGroup(server):
+		if !errors.Is(err, fatal) {
+			t.Fatal("Expected the serve error, received", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RunGroup did not return after a serve error")
+	}
+	if server.IsListening() {
+		t.Fatal("Server should have been stopped")
+	}
+	if reason := server.StopReason(); reason != ShutdownServeError {
+		t.Fatal("Expected serve error shutdown reason, found", reason)
+	}
+}
+
+func runGroup(server *Server) <-chan error {
+	result := make(chan error, 1)
+	go func() { result <- server.RunGroup(context.Background(), "127.0.0.1:") }()
+	return result
+}
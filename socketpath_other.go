@@ -0,0 +1,6 @@
+//go:build !unix
+
+package httpserver
+
+// maxSocketPath is the size of sockaddr_un's path on Windows.
+const maxSocketPath = 108
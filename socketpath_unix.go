@@ -0,0 +1,8 @@
+//go:build unix
+
+package httpserver
+
+import "syscall"
+
+// maxSocketPath is the size of sockaddr_un's path on this platform.
+const maxSocketPath = len(syscall.RawSockaddrUnix{}.Path)
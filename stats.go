@@ -0,0 +1,134 @@
+package httpserver
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// ServerStats is a snapshot of a Server's counters, suitable for encoding as
+// JSON from a status endpoint.
+type ServerStats struct {
+	// Name is the Server's Name.
+	Name string `json:"name"`
+	// Uptime is the Server's Uptime.
+	Uptime time.Duration `json:"uptime_ns"`
+	// TotalRequests counts every request received since the Server was
+	// created, including those answered by middleware.
+	TotalRequests int64 `json:"total_requests"`
+	// InFlight is the number of requests currently being handled.
+	InFlight int64 `json:"in_flight"`
+	// ActiveConnections is the number of open client connections, not
+	// counting those that have been hijacked.
+	ActiveConnections int64 `json:"active_connections"`
+	// AcceptedConnections is the Server's AcceptedConnections.
+	AcceptedConnections int64 `json:"accepted_connections"`
+	// BytesIn and BytesOut count request and response body bytes. Headers
+	// and protocol framing are not included.
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+}
+
+// Stats returns a snapshot of the Server's counters. It is safe to call at
+// any time, including before Start, when all values are zero.
+func (s *Server) Stats() ServerStats {
+	return ServerStats{
+		Name:                s.Name(),
+		Uptime:              s.Uptime(),
+		TotalRequests:       s.totalRequests.Load(),
+		InFlight:            s.inFlight.Load(),
+		ActiveConnections:   s.activeConns.Load(),
+		AcceptedConnections: s.acceptedConns.Load(),
+		BytesIn:             s.bytesIn.Load(),
+		BytesOut:            s.bytesOut.Load(),
+	}
+}
+
+// SetIdleWindow sets how long the Server must go without requests before
+// IsIdle reports it idle. Zero, the default, means it is idle whenever no
+// requests are in flight.
+func (s *Server) SetIdleWindow(window time.Duration) {
+	s.idleWindow = window
+}
+
+// IsIdle reports whether the Server has no requests in flight and none has
+// started or finished within the idle window, so that an autoscaler polling it
+// can tell when an instance is safe to terminate. A Server that has served no
+// requests counts its window from Start.
+func (s *Server) IsIdle() bool {
+	if s.inFlight.Load() > 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, s.lastActivity.Load())) >= s.idleWindow
+}
+
+// EnableIdleShutdown makes the Server stop itself gracefully once it has been
+// idle, with no requests in flight and none started or finished, for the
+// given duration, so that on-demand tools exit when unused. Each request
+// restarts the countdown. StopReason reports ShutdownIdle when it fires.
+func (s *Server) EnableIdleShutdown(idle time.Duration) {
+	s.idleShutdown = idle
+}
+
+func (s *Server) stopWhenIdle(idle time.Duration, done <-chan struct{}) {
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+		remaining := idle - time.Since(time.Unix(0, s.lastActivity.Load()))
+		if s.inFlight.Load() > 0 {
+			remaining = idle
+		}
+		if remaining <= 0 {
+			s.logf("Idle for %s, stopping", idle)
+			s.stop(context.Background(), ShutdownIdle)
+			return
+		}
+		timer.Reset(remaining)
+	}
+}
+
+// maxStatusCode bounds the status codes counted by StatusCounts.
+const maxStatusCode = 599
+
+// StatusCounts returns the number of responses sent with each status code
+// since the Server was last started, omitting codes that have not been sent.
+// Like BytesOut it counts responses generated by the Server's middleware.
+// Handlers that write no status are counted as 200.
+func (s *Server) StatusCounts() map[int]int64 {
+	counts := make(map[int]int64)
+	for code := range s.statusCounts {
+		if n := s.statusCounts[code].Load(); n > 0 {
+			counts[code] = n
+		}
+	}
+	return counts
+}
+
+// StatusClassCounts returns the responses counted by StatusCounts grouped by
+// class, with keys "1xx" through "5xx".
+func (s *Server) StatusClassCounts() map[string]int64 {
+	counts := map[string]int64{"1xx": 0, "2xx": 0, "3xx": 0, "4xx": 0, "5xx": 0}
+	for code, n := range s.StatusCounts() {
+		if code >= 100 {
+			counts[strconv.Itoa(code/100)+"xx"] += n
+		}
+	}
+	return counts
+}
+
+func (s *Server) countStatus(code int) {
+	if code >= 0 && code <= maxStatusCode {
+		s.statusCounts[code].Add(1)
+	}
+}
+
+func (s *Server) resetStatusCounts() {
+	for code := range s.statusCounts {
+		s.statusCounts[code].Store(0)
+	}
+}
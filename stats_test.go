@@ -0,0 +1,193 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		io.Copy(ioutil.Discard, request.Body)
+		writer.Write([]byte("hello"))
+	})
+	if stats := server.Stats(); stats != (ServerStats{}) {
+		t.Fatalf("Expected zero stats before Start, found %+v", stats)
+	}
+	base := startServer(t, server)
+	get(t, base+"/")
+	response, err := http.Post(base+"/", "text/plain", strings.NewReader("1234567"))
+	if err != nil {
+		t.Fatal("Request failed:", err)
+	}
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+
+	stats := server.Stats()
+	if stats.TotalRequests != 2 || stats.InFlight != 0 {
+		t.Fatalf("Unexpected request counts: %+v", stats)
+	}
+	if stats.BytesIn != 7 || stats.BytesOut != 10 {
+		t.Fatalf("Unexpected byte counts: %+v", stats)
+	}
+	if stats.ActiveConnections != 1 {
+		t.Fatalf("Expected 1 idle keep-alive connection, found %d", stats.ActiveConnections)
+	}
+	if stats.Uptime <= 0 {
+		t.Fatal("Expected positive uptime, found", stats.Uptime)
+	}
+	if _, err := json.Marshal(stats); err != nil {
+		t.Fatal("Failed to encode stats:", err)
+	}
+}
+
+func TestAcceptedConnections(t *testing.T) {
+	server := New(writeString("ok"))
+	base := startServer(t, server)
+	conn, err := net.Dial("tcp", server.Address().String())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer conn.Close()
+	for deadline := time.Now().Add(time.Second); server.AcceptedConnections() != 1; {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the raw connection to be accepted, found", server.AcceptedConnections())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := server.Stats(); stats.TotalRequests != 0 || stats.AcceptedConnections != 1 {
+		t.Fatalf("Expected an accepted connection without requests: %+v", stats)
+	}
+	get(t, base+"/")
+	if stats := server.Stats(); stats.TotalRequests != 1 || stats.AcceptedConnections != 2 {
+		t.Fatalf("Expected a second connection with one request: %+v", stats)
+	}
+}
+
+func TestStatusCounts(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/missing":
+			http.NotFound(writer, request)
+		case "/error":
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	server.SetMaxURLLength(20)
+	base := startServer(t, server)
+	for _, path := range []string{"/", "/", "/missing", "/error", "/a-path-that-is-far-too-long"} {
+		get(t, base+path)
+	}
+	expected := map[int]int64{200: 2, 404: 1, 414: 1, 500: 1}
+	deadline := time.Now().Add(time.Second)
+	counts := server.StatusCounts()
+	for !reflect.DeepEqual(counts, expected) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		counts = server.StatusCounts()
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("Expected status counts %v, found %v", expected, counts)
+	}
+	classes := map[string]int64{"1xx": 0, "2xx": 2, "3xx": 0, "4xx": 2, "5xx": 1}
+	if found := server.StatusClassCounts(); !reflect.DeepEqual(found, classes) {
+		t.Fatalf("Expected class counts %v, found %v", classes, found)
+	}
+	<-server.Stop()
+	startServer(t, server)
+	if counts := server.StatusCounts(); len(counts) != 0 {
+		t.Fatal("Expected counts to reset on Start, found", counts)
+	}
+}
+
+func TestIsIdle(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/block" {
+			close(entered)
+			<-release
+		}
+	})
+	server.SetIdleWindow(100 * time.Millisecond)
+	base := startServer(t, server)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		get(t, base+"/block")
+	}()
+	<-entered
+	time.Sleep(150 * time.Millisecond)
+	if server.IsIdle() {
+		t.Fatal("Idle with a request in flight")
+	}
+	close(release)
+	<-done
+	if server.IsIdle() {
+		t.Fatal("Idle within the window after a request")
+	}
+	deadline := time.Now().Add(time.Second)
+	for !server.IsIdle() {
+		if time.Now().After(deadline) {
+			t.Fatal("Never became idle after the window passed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIdleShutdown(t *testing.T) {
+	server := New(writeString("OK"))
+	server.SetQuiet(true)
+	server.EnableIdleShutdown(100 * time.Millisecond)
+	start := time.Now()
+	base := startServer(t, server)
+	for i := 0; i < 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		get(t, base+"/")
+	}
+	select {
+	case <-server.Wait():
+	case <-time.After(time.Second):
+		t.Fatal("Server did not stop when idle")
+	}
+	if elapsed := time.Since(start); elapsed < 280*time.Millisecond {
+		t.Fatal("Requests did not restart the idle countdown, stopped after", elapsed)
+	}
+	if reason := server.StopReason(); reason != ShutdownIdle {
+		t.Fatal("Expected idle shutdown reason, found", reason)
+	}
+
+	startServer(t, server)
+	<-server.Stop()
+	if reason := server.StopReason(); reason != ShutdownStop {
+		t.Fatal("Expected an external Stop to win, found", reason)
+	}
+}
+
+func TestName(t *testing.T) {
+	server := New(writeString("OK"))
+	startServer(t, server)
+	if name := server.Stats().Name; name != server.Address().String() {
+		t.Fatalf("Expected the name to default to the address, found %q", name)
+	}
+	<-server.Stop()
+
+	var buffer bytes.Buffer
+	server.SetLogger(log.New(&buffer, "", 0))
+	server.SetName("admin")
+	startServer(t, server)
+	<-server.Stop()
+	if server.Name() != "admin" || server.Stats().Name != "admin" {
+		t.Fatalf("Expected name admin, found %q", server.Name())
+	}
+	if !strings.HasPrefix(buffer.String(), "admin: Listening for HTTP requests") {
+		t.Fatalf("Expected log lines labelled with the name, found %q", buffer.String())
+	}
+}
@@ -0,0 +1,48 @@
+package httpserver
+
+import "time"
+
+// NoTimeout may be passed to SetIdleTimeout to disable the idle timeout even
+// when a read timeout is set.
+const NoTimeout time.Duration = -1
+
+// SetReadTimeout sets the maximum duration for reading an entire request,
+// including the body, as http.Server.ReadTimeout. Unless SetIdleTimeout is
+// also called, it also becomes the keep-alive idle timeout; see
+// EffectiveIdleTimeout.
+func (s *Server) SetReadTimeout(timeout time.Duration) {
+	s.readTimeout = timeout
+}
+
+// SetReadHeaderTimeout sets the maximum duration for reading request headers,
+// as http.Server.ReadHeaderTimeout. If zero the read timeout is used.
+func (s *Server) SetReadHeaderTimeout(timeout time.Duration) {
+	s.readHeaderTimeout = timeout
+}
+
+// SetWriteTimeout sets the maximum duration before timing out writes of a
+// response, as http.Server.WriteTimeout.
+func (s *Server) SetWriteTimeout(timeout time.Duration) {
+	s.writeTimeout = timeout
+}
+
+// SetIdleTimeout sets how long a keep-alive connection may wait for its next
+// request, as http.Server.IdleTimeout. If it is never set, net/http uses the
+// read timeout instead; pass NoTimeout to keep idle connections open
+// regardless of the read timeout.
+func (s *Server) SetIdleTimeout(timeout time.Duration) {
+	s.idleTimeout = timeout
+}
+
+// EffectiveIdleTimeout returns the idle timeout the Server applies to
+// keep-alive connections, after net/http's fallback to the read timeout.
+// Zero means idle connections are kept open indefinitely.
+func (s *Server) EffectiveIdleTimeout() time.Duration {
+	switch {
+	case s.idleTimeout > 0:
+		return s.idleTimeout
+	case s.idleTimeout == 0 && s.readTimeout > 0:
+		return s.readTimeout
+	}
+	return 0
+}
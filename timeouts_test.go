@@ -0,0 +1,42 @@
+package httpserver
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEffectiveIdleTimeout(t *testing.T) {
+	for _, test := range []struct {
+		read, idle, expected time.Duration
+	}{
+		{0, 0, 0},
+		{time.Second, 0, time.Second},
+		{time.Second, 5 * time.Second, 5 * time.Second},
+		{time.Second, NoTimeout, 0},
+		{0, 5 * time.Second, 5 * time.Second},
+	} {
+		server := New(writeString("OK"))
+		server.SetReadTimeout(test.read)
+		server.SetIdleTimeout(test.idle)
+		if timeout := server.EffectiveIdleTimeout(); timeout != test.expected {
+			t.Errorf("Read %s, idle %s: expected %s, found %s", test.read, test.idle, test.expected, timeout)
+		}
+	}
+}
+
+func TestIdleTimeoutFallbackLogged(t *testing.T) {
+	var buffer bytes.Buffer
+	server := New(writeString("OK"))
+	server.SetLogger(log.New(&buffer, "", 0))
+	server.SetReadTimeout(time.Second)
+	startServer(t, server)
+	if server.server.IdleTimeout != 0 || server.server.ReadTimeout != time.Second {
+		t.Fatalf("Unexpected http.Server timeouts: read %s, idle %s", server.server.ReadTimeout, server.server.IdleTimeout)
+	}
+	if !strings.Contains(buffer.String(), "using read timeout of 1s") {
+		t.Fatalf("Expected fallback to be logged, found %q", buffer.String())
+	}
+}
@@ -0,0 +1,274 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TLSHandshakeError is passed to the TLS error handler when a connection
+// fails its TLS handshake.
+type TLSHandshakeError struct {
+	// RemoteAddr is the address of the client that failed the handshake.
+	RemoteAddr string
+	// Err describes why the handshake failed.
+	Err error
+}
+
+func (e *TLSHandshakeError) Error() string {
+	return fmt.Sprintf("TLS handshake error from %s: %v", e.RemoteAddr, e.Err)
+}
+
+func (e *TLSHandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// SetTLSErrorHandler sets a function that is called with a *TLSHandshakeError
+// whenever a connection fails its TLS handshake, such as when a client
+// presents no certificate or an untrusted one. Handshake errors passed to the
+// handler are not also written to the error log.
+func (s *Server) SetTLSErrorHandler(handler func(err error)) {
+	s.tlsErrorHandler = handler
+}
+
+// SetSuppressTLSHandshakeErrors drops the handshake errors that scanners and
+// impatient clients cause on public endpoints from the error log: connections
+// closed or reset mid-handshake, plaintext sent to the TLS port, and clients
+// offering no version or cipher suite in common. Every other handshake error,
+// including certificate problems, is still logged. It has no effect when a TLS
+// error handler is set, since that already diverts every handshake error.
+func (s *Server) SetSuppressTLSHandshakeErrors(suppress bool) {
+	s.suppressHandshakeErrors = suppress
+}
+
+// benignHandshakeErrors are fragments of the handshake errors suppressed by
+// SetSuppressTLSHandshakeErrors.
+var benignHandshakeErrors = []string{
+	"EOF",
+	"connection reset by peer",
+	"broken pipe",
+	"i/o timeout",
+	"tls: first record does not look like a TLS handshake",
+	"client sent an HTTP request to an HTTPS server",
+	"tls: unsupported SSLv2 handshake received",
+	"tls: client offered only unsupported versions",
+	"tls: no cipher suite supported by both client and server",
+	"tls: no application protocol",
+}
+
+func benignHandshakeError(cause string) bool {
+	for _, fragment := range benignHandshakeErrors {
+		if strings.Contains(cause, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsHandshakeErrorPrefix is how http.Server reports handshake failures to its
+// ErrorLog, which is the only place they surface.
+const tlsHandshakeErrorPrefix = "http: TLS handshake error from "
+
+// errorLogWriter receives the output of http.Server.ErrorLog, diverting TLS
+// handshake errors away from the log and labelling the rest with the Server's
+// name.
+type errorLogWriter struct {
+	server *Server
+}
+
+func (w errorLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+	if message, ok := strings.CutPrefix(line, tlsHandshakeErrorPrefix); ok {
+		addr, cause, _ := strings.Cut(message, ": ")
+		if w.server.tlsErrorHandler != nil {
+			w.server.tlsErrorHandler(&TLSHandshakeError{RemoteAddr: addr, Err: errors.New(cause)})
+			return len(p), nil
+		}
+		if w.server.suppressHandshakeErrors && benignHandshakeError(cause) {
+			return len(p), nil
+		}
+	}
+	w.server.print(line)
+	return len(p), nil
+}
+
+// errorLog returns the logger to use for http.Server.ErrorLog, or nil to leave
+// net/http's default in place.
+func (s *Server) errorLog() *log.Logger {
+	if s.tlsErrorHandler == nil && !s.suppressHandshakeErrors && s.name == "" {
+		return nil
+	}
+	return log.New(errorLogWriter{s}, "", 0)
+}
+
+// effectiveTLSConfig returns the tls.Config the Server listens with: a clone of
+// TLSConfig advertising the same ALPN protocols net/http would add itself.
+// Owning the config, rather than letting http.Server.ServeTLS clone it, lets
+// the Server keep adjusting it while running.
+func (s *Server) effectiveTLSConfig() *tls.Config {
+	config := s.TLSConfig.Clone()
+	config.NextProtos = slices.Clone(config.NextProtos)
+	if s.HTTP2Enabled() && !slices.Contains(config.NextProtos, "h2") {
+		config.NextProtos = append(config.NextProtos, "h2")
+	}
+	if (s.protocols == nil || s.protocols.HTTP1()) && !slices.Contains(config.NextProtos, "http/1.1") {
+		config.NextProtos = append(config.NextProtos, "http/1.1")
+	}
+	// Certificates are chosen by GetCertificate so that one loaded by
+	// ReloadCertificate replaces them, even for clients that send no SNI.
+	certificates, getCertificate := config.Certificates, config.GetCertificate
+	config.Certificates = nil
+	config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if certificate := s.certificate.Load(); certificate != nil {
+			return certificate, nil
+		}
+		if getCertificate != nil {
+			if certificate, err := getCertificate(hello); certificate != nil || err != nil {
+				return certificate, err
+			}
+		}
+		return selectCertificate(certificates, hello)
+	}
+	if selector := s.tlsConfigSelector; selector != nil {
+		nextProtos := config.NextProtos
+		config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			selected, err := selector(hello)
+			if err != nil || selected == nil || len(selected.NextProtos) > 0 {
+				return selected, err
+			}
+			selected = selected.Clone()
+			selected.NextProtos = nextProtos
+			return selected, nil
+		}
+	}
+	return config
+}
+
+// SetTLSConfigSelector sets a function that chooses the tls.Config for each
+// connection from its ClientHello, as tls.Config.GetConfigForClient does, so
+// that one listener can serve several domains with their own certificates and
+// policies such as client authentication, selected by SNI. Returning a nil
+// config uses TLSConfig. The ALPN protocols the Server would advertise are
+// added to returned configs that set none, so HTTP/2 keeps working. If
+// TLSConfig is nil, an empty one is created so that the Server serves TLS.
+func (s *Server) SetTLSConfigSelector(selector func(*tls.ClientHelloInfo) (*tls.Config, error)) {
+	if s.TLSConfig == nil {
+		s.TLSConfig = &tls.Config{}
+	}
+	s.tlsConfigSelector = selector
+}
+
+// SetTLSConfigFunc sets a function that builds the Server's TLS config each
+// time it is started, such as by fetching certificates from a secrets manager,
+// so that problems surface as an error from Start rather than at the first
+// handshake. The returned config replaces TLSConfig. If the function fails or
+// returns a nil config, Start returns the error without serving.
+func (s *Server) SetTLSConfigFunc(configFunc func() (*tls.Config, error)) {
+	s.tlsConfigFunc = configFunc
+}
+
+// EnableSelfSignedTLS generates a self-signed certificate in memory for hosts,
+// which may be names or IP addresses, and serves TLS with it, so HTTPS can be
+// tried locally without managing certificates. With no hosts the certificate
+// is for localhost, 127.0.0.1 and ::1. It is valid for 30 days, and is
+// replaced each time EnableSelfSignedTLS is called. Clients will not trust it
+// without being told to, so it is for development only and must not be used
+// in production. If TLSConfig is nil, one is created.
+func (s *Server) EnableSelfSignedTLS(hosts ...string) error {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"httpserver self-signed"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(30 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	if s.TLSConfig == nil {
+		s.TLSConfig = &tls.Config{}
+	}
+	s.TLSConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}
+	return nil
+}
+
+// EnableSessionTicketRotation replaces the key used to encrypt TLS session
+// tickets every interval while the Server is running. The previous key is
+// retained, so a ticket can resume a session for between one and two
+// intervals after it was issued.
+func (s *Server) EnableSessionTicketRotation(interval time.Duration) {
+	s.sessionTicketRotation = interval
+}
+
+func newSessionTicketKey() (key [32]byte) {
+	rand.Read(key[:])
+	return key
+}
+
+func rotateSessionTicketKeys(config *tls.Config, interval time.Duration, done <-chan struct{}) {
+	keys := [][32]byte{newSessionTicketKey()}
+	config.SetSessionTicketKeys(keys)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			keys = [][32]byte{newSessionTicketKey(), keys[0]}
+			config.SetSessionTicketKeys(keys)
+		}
+	}
+}
+
+// ALPNProtocol returns the application protocol negotiated with ALPN for the
+// connection request arrived on, such as "h2", or empty if the connection is
+// not TLS or the client did not use ALPN. Unlike Request.TLS it is taken from
+// the connection itself, so it is still available if middleware replaces the
+// request without copying the TLS state.
+func ALPNProtocol(request *http.Request) string {
+	if request.TLS != nil {
+		return request.TLS.NegotiatedProtocol
+	}
+	if conn := connFromContext(request.Context()); conn != nil {
+		if tlsConn, ok := conn.Conn.(*tls.Conn); ok {
+			return tlsConn.ConnectionState().NegotiatedProtocol
+		}
+	}
+	return ""
+}
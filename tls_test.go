@@ -0,0 +1,396 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testCertificate(t *testing.T, hosts ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func insecureClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+}
+
+func TestTLSErrorHandler(t *testing.T) {
+	errs := make(chan error, 10)
+	server := New(writeString("OK"))
+	server.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.SetTLSErrorHandler(func(err error) {
+		errs <- err
+	})
+	if err := server.Start("127.0.0.1:"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer server.Stop()
+	<-server.WaitForStart()
+	if _, err := insecureClient().Get(fmt.Sprintf("https://%s/", server.Address())); err == nil {
+		t.Fatal("Expected request without a client certificate to fail")
+	}
+	select {
+	case err := <-errs:
+		var handshakeErr *TLSHandshakeError
+		if !errors.As(err, &handshakeErr) || handshakeErr.RemoteAddr == "" {
+			t.Fatal("Unexpected TLS error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("TLS error handler not called")
+	}
+}
+
+func TestSessionTicketRotation(t *testing.T) {
+	server := New(writeString("OK"))
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")}}
+	server.EnableSessionTicketRotation(100 * time.Millisecond)
+	server.SetQuiet(true)
+	base := "https://" + startServer(t, server)[len("http://"):]
+	client := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			ClientSessionCache: tls.NewLRUClientSessionCache(1),
+		},
+	}}
+	resumed := func() bool {
+		response, err := client.Get(base + "/")
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		return response.TLS.DidResume
+	}
+	if resumed() {
+		t.Fatal("First connection should not resume a session")
+	}
+	if !resumed() {
+		t.Fatal("Expected session to resume before rotation")
+	}
+	time.Sleep(350 * time.Millisecond)
+	if resumed() {
+		t.Fatal("Expected session not to resume after its key was rotated out")
+	}
+}
+
+func TestTLSNegotiatesHTTP2(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		server := New(writeString("OK"))
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")}}
+		server.DisableHTTP2 = disable
+		base := "https://" + startServer(t, server)[len("http://"):]
+		client := &http.Client{Transport: &http.Transport{
+			ForceAttemptHTTP2: true,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		}}
+		response, err := client.Get(base + "/")
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		response.Body.Close()
+		expected := 2
+		if disable {
+			expected = 1
+		}
+		if response.ProtoMajor != expected {
+			t.Fatalf("Expected HTTP/%d, received %s", expected, response.Proto)
+		}
+	}
+}
+
+func TestIsTLS(t *testing.T) {
+	for _, useTLS := range []bool{false, true} {
+		var buffer bytes.Buffer
+		server := New(writeString("OK"))
+		server.SetLogger(log.New(&buffer, "", 0))
+		if useTLS {
+			server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")}}
+		}
+		startServer(t, server)
+		if server.IsTLS() != useTLS {
+			t.Fatalf("Expected IsTLS to be %v", useTLS)
+		}
+		expected := "Listening for HTTP requests on "
+		if useTLS {
+			expected = "Listening for HTTPS requests on "
+		}
+		if !strings.HasPrefix(buffer.String(), expected) {
+			t.Fatal("Unexpected log output:", buffer.String())
+		}
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	server := New(writeString("OK"))
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")}}
+	server.EnableHSTS(365*24*time.Hour, true, true)
+	base := "https://" + startServer(t, server)[len("http://"):]
+	response, err := insecureClient().Get(base + "/")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	response.Body.Close()
+	if hsts := response.Header.Get("Strict-Transport-Security"); hsts != "max-age=31536000; includeSubDomains; preload" {
+		t.Fatal("Unexpected Strict-Transport-Security:", hsts)
+	}
+}
+
+func TestConnectionHandler(t *testing.T) {
+	for _, http2 := range []bool{false, true} {
+		var mutex sync.Mutex
+		var conns []ConnInfo
+		server := New(writeString("OK"))
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")}}
+		server.SetConnectionHandler(func(info ConnInfo) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			conns = append(conns, info)
+		})
+		base := "https://" + startServer(t, server)[len("http://"):]
+		client := &http.Client{Transport: &http.Transport{
+			ForceAttemptHTTP2: http2,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		}}
+		for i := 0; i < 3; i++ {
+			response, err := client.Get(base + "/")
+			if err != nil {
+				t.Fatal("Unexpected error:", err)
+			}
+			ioutil.ReadAll(response.Body)
+			response.Body.Close()
+		}
+		mutex.Lock()
+		if len(conns) != 1 {
+			t.Fatalf("Expected one connection to be reported, found %d", len(conns))
+		}
+		info := conns[0]
+		mutex.Unlock()
+		// Without HTTP/2 the client does not use ALPN.
+		protocol := ""
+		if http2 {
+			protocol = "h2"
+		}
+		if !info.TLS || info.Protocol != protocol || info.TLSVersion != tls.VersionTLS13 || info.CipherSuite == 0 {
+			t.Fatalf("Unexpected connection info: %+v", info)
+		}
+		if info.RemoteAddr == nil || info.LocalAddr.String() != server.Address().String() {
+			t.Fatalf("Unexpected addresses: %+v", info)
+		}
+	}
+}
+
+func TestALPNProtocol(t *testing.T) {
+	server := New(func(writer http.ResponseWriter, request *http.Request) {
+		stripped := request.Clone(request.Context())
+		stripped.TLS = nil
+		fmt.Fprintf(writer, "%s|%s", ALPNProtocol(request), ALPNProtocol(stripped))
+	})
+	server.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")},
+		NextProtos:   []string{"custom/1", "http/1.1"},
+	}
+	address := startServer(t, server)[len("http://"):]
+	// net/http closes connections that negotiate a protocol it has no
+	// TLSNextProto handler for, so only the HTTP protocols are requested.
+	for _, protocol := range []string{"http/1.1", "h2"} {
+		client := &http.Client{Transport: &http.Transport{
+			ForceAttemptHTTP2: protocol == "h2",
+			DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialer := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true, NextProtos: []string{protocol}}}
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}}
+		response, err := client.Get("https://" + address + "/")
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if expected := protocol + "|" + protocol; string(body) != expected {
+			t.Fatalf("Expected %q, received %q", expected, body)
+		}
+	}
+}
+
+// logLines receives each line written to a log.Logger.
+type logLines chan string
+
+func (l logLines) Write(p []byte) (int, error) {
+	l <- string(p)
+	return len(p), nil
+}
+
+func TestSuppressTLSHandshakeErrors(t *testing.T) {
+	lines := make(logLines, 10)
+	server := New(writeString("OK"))
+	server.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.SetLogger(log.New(lines, "", 0))
+	server.SetSuppressTLSHandshakeErrors(true)
+	startServer(t, server)
+	<-lines
+	conn, err := net.Dial("tcp", server.Address().String())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	conn.Close()
+	conn, err = net.Dial("tcp", server.Address().String())
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	ioutil.ReadAll(conn)
+	conn.Close()
+	if _, err := insecureClient().Get(fmt.Sprintf("https://%s/", server.Address())); err == nil {
+		t.Fatal("Expected request without a client certificate to fail")
+	}
+	select {
+	case line := <-lines:
+		if !strings.Contains(line, "certificate") {
+			t.Fatal("Expected only the certificate error to be logged, found", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Certificate error not logged")
+	}
+}
+
+func TestTLSConfigSelector(t *testing.T) {
+	certificates := map[string]tls.Certificate{
+		"one.example": testCertificate(t, "one.example"),
+		"two.example": testCertificate(t, "two.example"),
+	}
+	server := New(writeString("OK"))
+	server.SetTLSConfigSelector(func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		certificate, ok := certificates[hello.ServerName]
+		if !ok {
+			return nil, fmt.Errorf("unknown server name %q", hello.ServerName)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{certificate}}, nil
+	})
+	startServer(t, server)
+	for name := range certificates {
+		conn, err := tls.Dial("tcp", server.Address().String(), &tls.Config{
+			ServerName:         name,
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h2", "http/1.1"},
+		})
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		state := conn.ConnectionState()
+		conn.Close()
+		if subject := state.PeerCertificates[0].Subject.CommonName; subject != name {
+			t.Errorf("Expected the certificate for %s, received one for %s", name, subject)
+		}
+		if state.NegotiatedProtocol != "h2" {
+			t.Errorf("Expected h2 to be negotiated for %s, found %q", name, state.NegotiatedProtocol)
+		}
+	}
+	if _, err := tls.Dial("tcp", server.Address().String(), &tls.Config{ServerName: "three.example", InsecureSkipVerify: true}); err == nil {
+		t.Fatal("Expected the handshake to fail for an unknown name")
+	}
+}
+
+func TestSelfSignedTLS(t *testing.T) {
+	server := New(writeString("OK"))
+	if err := server.EnableSelfSignedTLS(); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	startServer(t, server)
+	response, err := insecureClient().Get(fmt.Sprintf("https://%s/", server.Address()))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "OK" {
+		t.Fatalf("Unexpected body %q", body)
+	}
+	leaf := response.TLS.PeerCertificates[0]
+	if err := leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Fatal("Certificate not valid for 127.0.0.1:", err)
+	}
+	if err := leaf.VerifyHostname("localhost"); err != nil {
+		t.Fatal("Certificate not valid for localhost:", err)
+	}
+	if _, err := http.Get(fmt.Sprintf("https://%s/", server.Address())); err == nil {
+		t.Fatal("Expected a verifying client to reject the self-signed certificate")
+	}
+}
+
+func TestTLSConfigFunc(t *testing.T) {
+	server := New(writeString("OK"))
+	server.SetTLSConfigFunc(func() (*tls.Config, error) {
+		return nil, errors.New("secret unavailable")
+	})
+	err := server.Start("127.0.0.1:")
+	if err == nil {
+		<-server.Stop()
+		t.Fatal("Expected Start to fail")
+	}
+	if !strings.Contains(err.Error(), "TLS config") || !strings.Contains(err.Error(), "secret unavailable") {
+		t.Fatal("Expected a descriptive error, received", err)
+	}
+	if server.IsListening() {
+		t.Fatal("Server should not be listening")
+	}
+
+	certificate := testCertificate(t, "127.0.0.1")
+	server.SetTLSConfigFunc(func() (*tls.Config, error) {
+		return &tls.Config{Certificates: []tls.Certificate{certificate}}, nil
+	})
+	startServer(t, server)
+	response, err := insecureClient().Get(fmt.Sprintf("https://%s/", server.Address()))
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	response.Body.Close()
+	if !server.IsTLS() {
+		t.Fatal("Expected the Server to serve TLS with the built config")
+	}
+}
@@ -0,0 +1,93 @@
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// UnixSocketOptions controls the permissions of the socket file created by
+// StartUnix.
+type UnixSocketOptions struct {
+	// Mode is applied to the socket file with chmod. If zero the mode is
+	// left as created, which is subject to the process umask.
+	Mode os.FileMode
+	// User and Group name the owner and group applied with chown. Numeric
+	// IDs are also accepted. Either may be empty to leave it unchanged.
+	User  string
+	Group string
+}
+
+// StartUnix starts the Server listening on a Unix socket at path. The mode and
+// ownership in options are applied to the socket file after it is bound and
+// before any connection is served, so access can be restricted to a specific
+// user or group, such as the one a fronting proxy runs as. If they cannot be
+// applied the socket is removed and the error is returned.
+func (s *Server) StartUnix(path string, options UnixSocketOptions) error {
+	if err := s.lockStart(); err != nil {
+		return err
+	}
+	defer s.startMutex.Unlock()
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return socketPathError(path, err)
+	}
+	if err = applySocketOptions(path, options); err != nil {
+		listener.Close()
+		return err
+	}
+	if err = s.startListener("unix", listener); err != nil {
+		listener.Close()
+		return err
+	}
+	return nil
+}
+
+// socketPathError explains a failure to bind a Unix socket whose path is too
+// long for the platform, which the system reports only as an invalid
+// argument.
+func socketPathError(path string, err error) error {
+	if len(path) < maxSocketPath {
+		return err
+	}
+	return fmt.Errorf("httpserver: unix socket path is %d bytes, too long for this platform's %d byte limit; use a shorter path: %w", len(path), maxSocketPath, err)
+}
+
+func applySocketOptions(path string, options UnixSocketOptions) error {
+	uid, gid := -1, -1
+	if options.User != "" {
+		account, err := user.Lookup(options.User)
+		if err != nil {
+			if account, err = user.LookupId(options.User); err != nil {
+				return fmt.Errorf("httpserver: socket owner: %w", err)
+			}
+		}
+		if uid, err = strconv.Atoi(account.Uid); err != nil {
+			return fmt.Errorf("httpserver: socket owner %s has non-numeric uid %q", options.User, account.Uid)
+		}
+	}
+	if options.Group != "" {
+		group, err := user.LookupGroup(options.Group)
+		if err != nil {
+			if group, err = user.LookupGroupId(options.Group); err != nil {
+				return fmt.Errorf("httpserver: socket group: %w", err)
+			}
+		}
+		if gid, err = strconv.Atoi(group.Gid); err != nil {
+			return fmt.Errorf("httpserver: socket group %s has non-numeric gid %q", options.Group, group.Gid)
+		}
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			return fmt.Errorf("httpserver: chown socket: %w", err)
+		}
+	}
+	if options.Mode != 0 {
+		if err := os.Chmod(path, options.Mode); err != nil {
+			return fmt.Errorf("httpserver: chmod socket: %w", err)
+		}
+	}
+	return nil
+}
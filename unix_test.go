@@ -0,0 +1,96 @@
+package httpserver
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStartUnix(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("Current user unavailable:", err)
+	}
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Skip("Current group unavailable:", err)
+	}
+	path := filepath.Join(t.TempDir(), "server.sock")
+	server := New(writeString("unix"))
+	if err := server.StartUnix(path, UnixSocketOptions{Mode: 0660, User: current.Username, Group: group.Name}); err != nil {
+		t.Fatal("Failed to start:", err)
+	}
+	defer func() { <-server.Stop() }()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal("Failed to stat socket:", err)
+	}
+	if info.Mode().Perm() != 0660 {
+		t.Fatalf("Expected mode 0660, found %v", info.Mode().Perm())
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	response, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatal("Request failed:", err)
+	}
+	defer response.Body.Close()
+	if body, _ := ioutil.ReadAll(response.Body); string(body) != "unix" {
+		t.Fatalf("Unexpected body: %q", body)
+	}
+}
+
+func TestStartUnixUnknownGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.sock")
+	server := New(writeString("unix"))
+	if err := server.StartUnix(path, UnixSocketOptions{Group: "httpserver-no-such-group"}); err == nil {
+		<-server.Stop()
+		t.Fatal("Expected an error for an unknown group")
+	}
+	if server.IsListening() {
+		t.Fatal("Server should not be listening")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("Expected socket to be removed, stat returned:", err)
+	}
+}
+
+func TestStartUnixLongPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), strings.Repeat("s", maxSocketPath)+".sock")
+	server := New(writeString("unix"))
+	err := server.StartUnix(path, UnixSocketOptions{})
+	if err == nil {
+		<-server.Stop()
+		t.Fatal("Expected an error for an over-length path")
+	}
+	if message := err.Error(); !strings.Contains(message, "too long") || !strings.Contains(message, strconv.Itoa(maxSocketPath)) {
+		t.Fatal("Expected an error naming the limit, received", err)
+	}
+	if err := server.StartSocket(path); err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Fatal("Expected StartSocket to name the limit, received", err)
+	}
+}
+
+func TestUnixBaseURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.sock")
+	server := New(writeString("unix"))
+	server.SetQuiet(true)
+	if err := server.StartUnix(path, UnixSocketOptions{}); err != nil {
+		t.Fatal("Failed to start:", err)
+	}
+	defer func() { <-server.Stop() }()
+	if expected := "http+unix://" + url.PathEscape(path); server.BaseURL() != expected {
+		t.Fatalf("Expected %q, found %q", expected, server.BaseURL())
+	}
+}
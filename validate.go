@@ -0,0 +1,91 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Validate checks the Server's configuration for serving on address without
+// starting it, so that deployment pipelines can catch mistakes early. It
+// confirms that the Server has a handler or not found handler, that address
+// and the addresses of any challenge or admin listener can be bound (each is
+// released immediately), that TLS certificates parse, and that ALPN settings
+// agree with the HTTP/2 configuration. Every problem found is reported in the
+// returned error, which is nil if the configuration is valid. Call it before
+// Start.
+func (s *Server) Validate(address string) error {
+	var errs []error
+	if handler, _, _ := s.routes(); handler == nil && s.notFoundHandler == nil {
+		errs = append(errs, errors.New("httpserver: no handler"))
+	}
+	if err := s.checkBind(address); err != nil {
+		errs = append(errs, err)
+	}
+	for _, c := range s.companions {
+		if err := s.checkBind(c.address); err != nil {
+			errs = append(errs, fmt.Errorf("httpserver: %s listener: %w", c.name, err))
+		}
+	}
+	if s.TLSConfig != nil {
+		errs = append(errs, s.validateTLS()...)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) checkBind(address string) error {
+	listener, err := s.listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("httpserver: cannot bind: %w", err)
+	}
+	return listener.Close()
+}
+
+func (s *Server) validateTLS() []error {
+	var errs []error
+	config := s.TLSConfig
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil && s.tlsConfigSelector == nil && s.certificate.Load() == nil {
+		errs = append(errs, errors.New("httpserver: TLS config has no certificates"))
+	}
+	for i, certificate := range config.Certificates {
+		if err := checkCertificate(certificate); err != nil {
+			errs = append(errs, fmt.Errorf("httpserver: TLS certificate %d: %w", i, err))
+		}
+	}
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		errs = append(errs, errors.New("httpserver: TLS MinVersion is greater than MaxVersion"))
+	}
+	http2 := s.HTTP2Enabled()
+	if slices.Contains(config.NextProtos, "h2") && !http2 {
+		errs = append(errs, errors.New(`httpserver: TLS NextProtos offers "h2" but HTTP/2 is disabled`))
+	}
+	if http2 && config.MaxVersion != 0 && config.MaxVersion < tls.VersionTLS12 {
+		errs = append(errs, errors.New("httpserver: HTTP/2 requires TLS 1.2 or later"))
+	}
+	return errs
+}
+
+func checkCertificate(certificate tls.Certificate) error {
+	if len(certificate.Certificate) == 0 {
+		return errors.New("empty certificate chain")
+	}
+	if certificate.PrivateKey == nil {
+		return errors.New("missing private key")
+	}
+	leaf := certificate.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(certificate.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	if now := time.Now(); now.After(leaf.NotAfter) {
+		return fmt.Errorf("expired at %s", leaf.NotAfter)
+	} else if now.Before(leaf.NotBefore) {
+		return fmt.Errorf("not valid until %s", leaf.NotBefore)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	server := New(writeString("OK"))
+	server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")}}
+	if err := server.Validate("127.0.0.1:0"); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if server.IsListening() {
+		t.Fatal("Validate should not start the Server")
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	defer listener.Close()
+	server := New(nil)
+	server.TLSConfig = &tls.Config{NextProtos: []string{"h2"}}
+	server.DisableHTTP2 = true
+	err = server.Validate(listener.Addr().String())
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, problem := range []string{"no handler", "cannot bind", "no certificates", `offers "h2"`} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("Expected %q to be reported in %q", problem, err)
+		}
+	}
+	if err := New(writeString("OK")).Validate("no-port"); err == nil || !strings.Contains(err.Error(), "cannot bind") {
+		t.Fatal("Expected a bind error, received", err)
+	}
+	if err := New(writeString("OK")).Validate(""); err != nil {
+		t.Fatal("Expected the address Start accepts to be valid, received", err)
+	}
+}
@@ -0,0 +1,72 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultWebhookTimeout bounds the shutdown webhook when no timeout is given.
+const defaultWebhookTimeout = 5 * time.Second
+
+type shutdownWebhook struct {
+	url     string
+	timeout time.Duration
+}
+
+// SetShutdownWebhook has the Server POST a JSON object with its name and
+// address, such as {"name":"api","address":"10.0.0.5:8080"}, to url once it has
+// shut down, so that discovery systems can deregister it. The request is
+// given timeout to complete, or five seconds if timeout is not positive; a
+// failure or error status is logged and does not hold up shutdown any longer.
+// The webhook is called before the function set by SetShutdownHandler. An
+// empty url disables it.
+func (s *Server) SetShutdownWebhook(url string, timeout time.Duration) {
+	if url == "" {
+		s.shutdownWebhook = nil
+		return
+	}
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	s.shutdownWebhook = &shutdownWebhook{url: url, timeout: timeout}
+}
+
+func (s *Server) callShutdownWebhook(webhook *shutdownWebhook) {
+	var address string
+	if addr := s.Address(); addr != nil {
+		address = addr.String()
+	}
+	payload, err := json.Marshal(struct {
+		Name    string `json:"name"`
+		Address string `json:"address"`
+	}{s.Name(), address})
+	if err == nil {
+		err = postWebhook(webhook, payload)
+	}
+	if err != nil {
+		s.logf("Shutdown webhook failed: %s", err)
+	}
+}
+
+func postWebhook(webhook *shutdownWebhook, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhook.timeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("%s responded %s", webhook.url, response.Status)
+	}
+	return nil
+}
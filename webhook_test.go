@@ -0,0 +1,79 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownWebhook(t *testing.T) {
+	received := make(chan map[string]string, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var payload map[string]string
+		if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+		if request.Method != http.MethodPost || request.Header.Get("Content-Type") != "application/json" {
+			t.Error("Expected a JSON POST, got", request.Method, request.Header.Get("Content-Type"))
+		}
+		received <- payload
+	}))
+	defer hook.Close()
+
+	server := New(writeString("ok"))
+	server.SetName("api")
+	server.SetShutdownWebhook(hook.URL, time.Second)
+	startServer(t, server)
+	address := server.Address().String()
+	<-server.Stop()
+	select {
+	case payload := <-received:
+		if payload["name"] != "api" || payload["address"] != address {
+			t.Error("Unexpected payload:", payload)
+		}
+	default:
+		t.Fatal("Expected the webhook to be called before Stop returned")
+	}
+}
+
+func TestShutdownWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	hook := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-release
+	}))
+	defer hook.Close()
+	defer close(release)
+
+	var buffer bytes.Buffer
+	server := New(writeString("ok"))
+	server.SetLogger(log.New(&buffer, "", 0))
+	server.SetShutdownWebhook(hook.URL, 50*time.Millisecond)
+	startServer(t, server)
+	stopped := time.Now()
+	<-server.Stop()
+	if elapsed := time.Since(stopped); elapsed > time.Second {
+		t.Error("Expected the webhook timeout to bound shutdown, took", elapsed)
+	}
+	if !strings.Contains(buffer.String(), "Shutdown webhook failed") {
+		t.Errorf("Expected the failure to be logged, got %q", buffer.String())
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+	buffer.Reset()
+	server = New(writeString("ok"))
+	server.SetLogger(log.New(&buffer, "", 0))
+	server.SetShutdownWebhook(slow.URL, 0)
+	startServer(t, server)
+	<-server.Stop()
+	if strings.Contains(buffer.String(), "Shutdown webhook failed") {
+		t.Errorf("Expected a zero timeout to use the default, got %q", buffer.String())
+	}
+}